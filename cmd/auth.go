@@ -0,0 +1,56 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+
+	provider "github.com/dpfg/kinohub-core/internal/provider"
+	"github.com/dpfg/kinohub-core/internal/provider/kinopub"
+)
+
+// AuthCommand groups commands to connect 3rd party accounts
+type AuthCommand struct {
+	KinoPub AuthKinoPubCommand `command:"kinopub" description:"Authorize the device in kinopub account"`
+}
+
+// AuthKinoPubCommand runs kinopub device authorization flow and saves the token
+type AuthKinoPubCommand struct {
+	DataLocation string `long:"data-location" env:"KINOHUB_DATA_LOCATION" default:".data/" description:"path to folder to store application data"`
+	Auth         struct {
+		KinoPub OAuthGroup `group:"kinopub" namespace:"kinopub" env-namespace:"KINOPUB" description:"KinoPub OAuth"`
+	} `group:"auth" namespace:"auth" env-namespace:"AUTH"`
+}
+
+// Execute authorizes the device. Called by flags parser
+func (cmd *AuthKinoPubCommand) Execute(args []string) error {
+	logger := newLogger()
+
+	storage := provider.JSONPreferenceStorage{
+		Path: cmd.DataLocation,
+	}
+	log := logger.WithField("prefix", "kinopub")
+
+	kpc := kinopub.KinoPubClientImpl{
+		ClientID:          cmd.Auth.KinoPub.CID,
+		ClientSecret:      cmd.Auth.KinoPub.CSEC,
+		PreferenceStorage: storage,
+		Tokens:            kinopub.NewTokenManager(storage, kinopub.DefaultRefreshMargin, log),
+		Logger:            log,
+	}
+
+	ctx := context.Background()
+
+	dc, err := kpc.RequestDeviceCode(ctx)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Open %s and enter the code: %s\n", dc.VerificationURI, dc.UserCode)
+
+	if _, err = kinopub.WaitDeviceToken(ctx, kpc, dc); err != nil {
+		return err
+	}
+
+	logger.Infof("Kinopub token has been saved to %s", cmd.DataLocation)
+	return nil
+}
@@ -0,0 +1,82 @@
+package cmd
+
+import (
+	"os"
+
+	provider "github.com/dpfg/kinohub-core/internal/provider"
+	"github.com/pkg/errors"
+)
+
+// CacheCommand groups commands to manage the metadata cache
+type CacheCommand struct {
+	Export CacheExportCommand `command:"export" description:"Export all cached entries to the archive"`
+	Import CacheImportCommand `command:"import" description:"Merge cached entries from the archive"`
+}
+
+// CacheExportCommand writes content of the cache to the archive
+type CacheExportCommand struct {
+	DataLocation string `long:"data-location" env:"KINOHUB_DATA_LOCATION" default:".data/" description:"path to folder to store application data"`
+	Out          string `long:"out" required:"true" description:"path to the archive to create"`
+}
+
+// CacheImportCommand merges content of the archive into the cache
+type CacheImportCommand struct {
+	DataLocation string `long:"data-location" env:"KINOHUB_DATA_LOCATION" default:".data/" description:"path to folder to store application data"`
+	Args         struct {
+		File string `positional-arg-name:"file" description:"path to the archive to import"`
+	} `positional-args:"yes" required:"yes"`
+}
+
+// Execute exports the cache. Called by flags parser
+func (cmd *CacheExportCommand) Execute(args []string) error {
+	logger := newLogger()
+
+	scm, err := provider.OpenCacheManager(cmd.DataLocation, provider.CacheOptions{}, logger)
+	if err != nil {
+		return err
+	}
+	defer scm.Close()
+
+	f, err := os.Create(cmd.Out)
+	if err != nil {
+		return errors.Wrap(err, "Cannot create archive")
+	}
+
+	n, err := scm.Export(f)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+
+	if err != nil {
+		os.Remove(cmd.Out)
+		return err
+	}
+
+	logger.Infof("%d cache entries have been exported to %s", n, cmd.Out)
+	return nil
+}
+
+// Execute imports the cache. Called by flags parser
+func (cmd *CacheImportCommand) Execute(args []string) error {
+	logger := newLogger()
+
+	scm, err := provider.OpenCacheManager(cmd.DataLocation, provider.CacheOptions{}, logger)
+	if err != nil {
+		return err
+	}
+	defer scm.Close()
+
+	f, err := os.Open(cmd.Args.File)
+	if err != nil {
+		return errors.Wrap(err, "Cannot open archive")
+	}
+	defer f.Close()
+
+	report, err := scm.Import(f)
+	if err != nil {
+		return err
+	}
+
+	logger.Infof("%d cache entries have been imported, %d skipped as outdated", report.Imported, report.Skipped)
+	return nil
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"github.com/markbates/pkger"
 	"net/http"
+	"time"
 
 	"github.com/dpfg/kinohub-core/internal/player"
 	provider "github.com/dpfg/kinohub-core/internal/provider"
@@ -11,6 +12,8 @@ import (
 	"github.com/dpfg/kinohub-core/internal/provider/tmdb"
 	"github.com/dpfg/kinohub-core/internal/provider/trakt"
 	"github.com/dpfg/kinohub-core/internal/services"
+	"github.com/dpfg/kinohub-core/internal/stream"
+	httpu "github.com/dpfg/kinohub-core/pkg/http"
 	"github.com/go-chi/chi"
 	"github.com/go-chi/chi/middleware"
 	"github.com/rs/cors"
@@ -21,14 +24,19 @@ import (
 
 // ServerCommand with available flags and env. variables
 type ServerCommand struct {
-	Port         int    `long:"port" env:"KINOHUB_PORT" default:"8090" description:"port"`
-	SiteName     string `long:"site-name" default:"localhost" description:"Site name used by 3rd parties"`
-	DataLocation string `long:"data-location" env:"KINOHUB_DATA_LOCATION" default:".data/" description:"path to folder to store application data"`
-	Auth         struct {
+	Port           int           `long:"port" env:"KINOHUB_PORT" default:"8090" description:"port"`
+	SiteName       string        `long:"site-name" default:"localhost" description:"Site name used by 3rd parties"`
+	DataLocation   string        `long:"data-location" env:"KINOHUB_DATA_LOCATION" default:".data/" description:"path to folder to store application data"`
+	RequestTimeout time.Duration `long:"request-timeout" env:"KINOHUB_REQUEST_TIMEOUT" default:"60s" description:"deadline of the API requests"`
+	Auth           struct {
 		Trakt   OAuthGroup  `group:"trakt" namespace:"trakt" env-namespace:"TRAKT" description:"Trakt OAuth"`
 		TMBD    APIKeyGroup `group:"tmdb" namespace:"tmdb" env-namespace:"TMDB" description:"TMDB API Auth"`
 		KinoPub OAuthGroup  `group:"kinopub" namespace:"kinopub" env-namespace:"KINOPUB" description:"KinoPub OAuth"`
 	} `group:"auth" namespace:"auth" env-namespace:"AUTH"`
+	Cache  CacheGroup  `group:"cache" namespace:"cache" env-namespace:"CACHE"`
+	WarmUp WarmUpGroup `group:"warmup" namespace:"warmup" env-namespace:"WARMUP"`
+	Stream StreamGroup `group:"stream" namespace:"stream" env-namespace:"STREAM"`
+	HTTP   HTTPGroup   `group:"http" namespace:"http" env-namespace:"HTTP"`
 }
 
 // OAuthGroup defines options group for oauth params
@@ -37,6 +45,36 @@ type OAuthGroup struct {
 	CSEC string `long:"csec" env:"CSEC" description:"OAuth client secret"`
 }
 
+// CacheGroup defines options of the metadata cache
+type CacheGroup struct {
+	MemoryEntries   int           `long:"memory-entries" env:"MEMORY_ENTRIES" default:"1000" description:"max number of entries kept in memory per cache"`
+	MemoryBytes     int64         `long:"memory-bytes" env:"MEMORY_BYTES" default:"8388608" description:"max size in bytes of entries kept in memory per cache"`
+	SweepInterval   time.Duration `long:"sweep-interval" env:"SWEEP_INTERVAL" default:"1h" description:"how often expired entries are removed from disk, 0 to disable"`
+	MaxSize         int64         `long:"max-size" env:"MAX_SIZE" default:"268435456" description:"max size in bytes of the cache database file, 0 for no limit"`
+	StaleRevalidate time.Duration `long:"stale-while-revalidate" env:"STALE_WHILE_REVALIDATE" default:"24h" description:"how long an expired entry is served while it's refreshed in background"`
+	StaleIfError    time.Duration `long:"stale-if-error" env:"STALE_IF_ERROR" default:"720h" description:"how long an expired entry is served when the remote service fails"`
+	Policies        []string      `long:"policy" env:"POLICY" env-delim:";" description:"per cache policy, e.g. KP_GetItemById:ttl=2h,max-entries=500 or TMDB_ENTITIES:no-cache"`
+}
+
+// WarmUpGroup defines schedule of the cache warm-up
+type WarmUpGroup struct {
+	At       string        `long:"at" env:"AT" description:"daily time of the warm-up, e.g. 06:30"`
+	Interval time.Duration `long:"interval" env:"INTERVAL" description:"interval between the warm-ups if daily time is not set"`
+	Days     int           `long:"days" env:"DAYS" default:"7" description:"number of the coming days to prefetch releases for"`
+}
+
+// StreamGroup defines profiles used to select the video stream
+type StreamGroup struct {
+	Profiles []string `long:"profile" env:"PROFILE" env-delim:";" description:"named stream profile, e.g. lg-tv:max-height=1080,format=hls,no-hevc,voice=LostFilm"`
+}
+
+// HTTPGroup defines options of the requests to the providers
+type HTTPGroup struct {
+	KinoPubTimeout time.Duration `long:"kinopub-timeout" env:"KINOPUB_TIMEOUT" description:"timeout of a single request to kinopub, the provider default if not set"`
+	TMDBTimeout    time.Duration `long:"tmdb-timeout" env:"TMDB_TIMEOUT" description:"timeout of a single request to TMDB, the provider default if not set"`
+	TraktTimeout   time.Duration `long:"trakt-timeout" env:"TRAKT_TIMEOUT" description:"timeout of a single request to Trakt, the provider default if not set"`
+}
+
 // APIKeyGroup defines auth options that reliy on a single API Key.
 type APIKeyGroup struct {
 	Key string `long:"key" env:"KEY" description:"API key"`
@@ -56,20 +94,40 @@ func (cmd *ServerCommand) Execute(args []string) error {
 	}
 
 	tmdbc := cmd.makeTMDBClient(logger, cacheFactory)
-	kpc := cmd.makeKinoPubClient(cacheFactory, logger)
+	links := cmd.makeLinkStore()
+	kpc := cmd.makeKinoPubClient(cacheFactory, links, logger)
 	trakt := cmd.makeTraktIntegration(logger)
 
+	streams, err := cmd.makeStreamProfiles(logger)
+	if err != nil {
+		return err
+	}
+
+	warmUp, err := cmd.makeWarmUp(trakt.Client, kpc, tmdbc, logger)
+	if err != nil {
+		return err
+	}
+	go warmUp.Schedule()
+
 	server := Server{
 		port:           cmd.Port,
+		requestTimeout: cmd.RequestTimeout,
 		logger:         logger,
 		cacheFactory:   cacheFactory,
 		trakt:          trakt,
+		kinopubAuth:    cmd.makeKinoPubIntegration(kpc, logger),
 		tmdb:           tmdbc,
 		kinopub:        kpc,
 		search:         cmd.makeContentSearch(kpc, tmdbc, logger),
+		bookmarks:      cmd.makeBookmarks(kpc, logger),
+		discover:       cmd.makeDiscover(kpc, logger),
 		feedService:    cmd.makeFeed(trakt.Client, kpc, tmdbc, logger),
-		infoService:    cmd.makeContentBrowser(kpc, tmdbc, logger),
+		infoService:    cmd.makeContentBrowser(kpc, tmdbc, streams, logger),
+		streams:        streams,
 		embeddedPlayer: cmd.makeEmbeddedPlayer(logger),
+		system:         cmd.makeSystemModule(cacheFactory, kpc, tmdbc),
+		links:          cmd.makeLinksModule(links, kpc, tmdbc, logger),
+		warmUp:         warmUp,
 	}
 
 	server.serve()
@@ -78,7 +136,21 @@ func (cmd *ServerCommand) Execute(args []string) error {
 }
 
 func (cmd *ServerCommand) makeCacheFactory(logger *logrus.Logger) (provider.CacheFactory, error) {
-	return provider.NewCacheFactory(cmd.DataLocation, logger)
+	policies, err := provider.ParseCachePolicies(cmd.Cache.Policies)
+	if err != nil {
+		return nil, err
+	}
+
+	return provider.NewCacheFactory(cmd.DataLocation, provider.CacheOptions{
+		MemoryMaxEntries: cmd.Cache.MemoryEntries,
+		MemoryMaxBytes:   cmd.Cache.MemoryBytes,
+		SweepInterval:    cmd.Cache.SweepInterval,
+		MaxFileSize:      cmd.Cache.MaxSize,
+
+		StaleWhileRevalidate: cmd.Cache.StaleRevalidate,
+		StaleIfError:         cmd.Cache.StaleIfError,
+		Policies:             policies,
+	}, logger), nil
 }
 
 func (cmd *ServerCommand) makeTraktIntegration(logger *logrus.Logger) *trakt.Integration {
@@ -96,6 +168,7 @@ func (cmd *ServerCommand) makeTraktIntegration(logger *logrus.Logger) *trakt.Int
 		PreferenceStorage: provider.JSONPreferenceStorage{
 			Path: cmd.DataLocation,
 		},
+		HTTP:   cmd.makeHTTPClient(trakt.HTTPOptions, cmd.HTTP.TraktTimeout, logger),
 		Logger: logger.WithField("prefix", "trakt"),
 	}}
 }
@@ -108,27 +181,97 @@ func (cmd *ServerCommand) makeContentSearch(kpc kinopub.KinoPubClient, tmdbc tmd
 	}
 }
 
+func (cmd *ServerCommand) makeBookmarks(kpc kinopub.KinoPubClient, logger *logrus.Logger) *services.Bookmarks {
+	return &services.Bookmarks{
+		Kinopub: kpc,
+		Logger:  logger.WithField("prefix", "bookmarks"),
+	}
+}
+
+func (cmd *ServerCommand) makeDiscover(kpc kinopub.KinoPubClient, logger *logrus.Logger) *services.Discover {
+	return &services.Discover{
+		Kinopub: kpc,
+		Logger:  logger.WithField("prefix", "discover"),
+	}
+}
+
 func (cmd *ServerCommand) makeFeed(trakt *trakt.Client, kinopub kinopub.KinoPubClient, tmdbc tmdb.Client, logger *logrus.Logger) services.Feed {
 	return services.NewFeed(trakt, kinopub, tmdbc, logger.WithField("prefix", "feed"))
 }
 
-func (cmd *ServerCommand) makeContentBrowser(kinopub kinopub.KinoPubClient, tmdbc tmdb.Client, logger *logrus.Logger) services.ContentBrowser {
-	return services.NewContentBrowser(kinopub, tmdbc)
+func (cmd *ServerCommand) makeWarmUp(trakt *trakt.Client, kinopub kinopub.KinoPubClient, tmdbc tmdb.Client, logger *logrus.Logger) (*services.WarmUp, error) {
+	return services.NewWarmUp(services.WarmUpSchedule{
+		At:       cmd.WarmUp.At,
+		Interval: cmd.WarmUp.Interval,
+		Days:     cmd.WarmUp.Days,
+	}, trakt, kinopub, tmdbc, logger.WithField("prefix", "warm-up"))
+}
+
+func (cmd *ServerCommand) makeContentBrowser(kinopub kinopub.KinoPubClient, tmdbc tmdb.Client, streams *stream.Profiles, logger *logrus.Logger) services.ContentBrowser {
+	return services.NewContentBrowser(kinopub, tmdbc, streams, logger.WithField("prefix", "content-browser"))
+}
+
+func (cmd *ServerCommand) makeStreamProfiles(logger *logrus.Logger) (*stream.Profiles, error) {
+	profiles, err := stream.ParseProfiles(cmd.Stream.Profiles)
+	if err != nil {
+		return nil, err
+	}
+
+	return stream.NewProfiles(profiles, provider.JSONPreferenceStorage{
+		Path: cmd.DataLocation,
+	}, logger.WithField("prefix", "stream")), nil
 }
 
 func (cmd *ServerCommand) makeEmbeddedPlayer(logger *logrus.Logger) *player.Server {
 	return player.NewServer(logger.WithField("prefix", "hub"))
 }
 
-func (cmd *ServerCommand) makeKinoPubClient(cf provider.CacheFactory, logger *logrus.Logger) kinopub.KinoPubClient {
+func (cmd *ServerCommand) makeSystemModule(cf provider.CacheFactory, kpc kinopub.KinoPubClient, tmdbc tmdb.Client) *services.SystemModule {
+	return &services.SystemModule{
+		Cache:   cf,
+		Kinopub: kpc,
+		TMDB:    tmdbc,
+	}
+}
+
+func (cmd *ServerCommand) makeLinkStore() *kinopub.LinkStore {
+	return kinopub.NewLinkStore(provider.JSONPreferenceStorage{
+		Path: cmd.DataLocation,
+	})
+}
+
+func (cmd *ServerCommand) makeLinksModule(links *kinopub.LinkStore, kpc kinopub.KinoPubClient, tmdbc tmdb.Client, logger *logrus.Logger) *services.LinksModule {
+	return &services.LinksModule{
+		Links:   links,
+		Kinopub: kpc,
+		TMDB:    tmdbc,
+		Logger:  logger.WithField("prefix", "links"),
+	}
+}
+
+func (cmd *ServerCommand) makeKinoPubClient(cf provider.CacheFactory, links *kinopub.LinkStore, logger *logrus.Logger) kinopub.KinoPubClientImpl {
+	storage := provider.JSONPreferenceStorage{
+		Path: cmd.DataLocation,
+	}
+	log := logger.WithField("prefix", "kinopub")
+
 	return kinopub.KinoPubClientImpl{
-		ClientID:     cmd.Auth.KinoPub.CID,
-		ClientSecret: cmd.Auth.KinoPub.CSEC,
-		PreferenceStorage: provider.JSONPreferenceStorage{
-			Path: cmd.DataLocation,
-		},
-		CacheFactory: cf,
-		Logger:       logger.WithField("prefix", "kinopub"),
+		ClientID:          cmd.Auth.KinoPub.CID,
+		ClientSecret:      cmd.Auth.KinoPub.CSEC,
+		PreferenceStorage: storage,
+		CacheFactory:      cf,
+		Links:             links,
+		Tokens:            kinopub.NewTokenManager(storage, kinopub.DefaultRefreshMargin, log),
+		HTTP:              cmd.makeHTTPClient(kinopub.HTTPOptions, cmd.HTTP.KinoPubTimeout, logger),
+		Logger:            log,
+	}
+}
+
+func (cmd *ServerCommand) makeKinoPubIntegration(kpc kinopub.KinoPubClientImpl, logger *logrus.Logger) *kinopub.Integration {
+	return &kinopub.Integration{
+		Auth:   kpc,
+		Tokens: kpc.Tokens,
+		Logger: logger.WithField("prefix", "kinopub"),
 	}
 }
 
@@ -139,22 +282,41 @@ func (cmd *ServerCommand) makeTMDBClient(logger *logrus.Logger, cf provider.Cach
 			Path: cmd.DataLocation,
 		},
 		Cache:  cf,
+		HTTP:   cmd.makeHTTPClient(tmdb.HTTPOptions, cmd.HTTP.TMDBTimeout, logger),
 		Logger: logger.WithField("prefix", "tmdb"),
 	}
 }
 
+// makeHTTPClient creates client with the provider's transport options. Zero timeout keeps the default one.
+func (cmd *ServerCommand) makeHTTPClient(opts httpu.TransportOptions, timeout time.Duration, logger *logrus.Logger) *http.Client {
+	if timeout > 0 {
+		opts.Timeout = timeout
+	}
+	opts.Logger = logger.WithField("prefix", opts.Name)
+
+	return httpu.NewClient(opts)
+}
+
 // Server with all available dependencies
 type Server struct {
-	port   int
-	logger *logrus.Logger
+	port           int
+	requestTimeout time.Duration
+	logger         *logrus.Logger
 
 	cacheFactory provider.CacheFactory
 	trakt        *trakt.Integration
+	kinopubAuth  *kinopub.Integration
 	kinopub      kinopub.KinoPubClient
 	tmdb         tmdb.Client
 	search       *services.ContentSearch
+	bookmarks    *services.Bookmarks
+	discover     *services.Discover
 	infoService  services.ContentBrowser
 	feedService  services.Feed
+	system       *services.SystemModule
+	warmUp       *services.WarmUp
+	streams      *stream.Profiles
+	links        *services.LinksModule
 
 	embeddedPlayer *player.Server
 }
@@ -165,16 +327,31 @@ func (server *Server) serve() {
 	router.Use(cors.AllowAll().Handler)
 	router.Use(middleware.Heartbeat("/ping"))
 	router.Use(middleware.Logger)
+	router.Use(httpu.StaleWarning)
 
 	router.Get("/", func(w http.ResponseWriter, r *http.Request) {
 		w.Write([]byte("kinohub v0.0.3"))
 	})
 
 	router.Mount("/trakt", server.trakt.Handler())
-	router.Mount("/api/search", server.search.Handler())
 
-	router.Group(server.infoService.Handler())
-	router.Group(server.feedService.Handler())
+	// context of the API requests is cancelled at the deadline, so are the calls to the providers
+	api := chi.Router(router)
+	if server.requestTimeout > 0 {
+		api = router.With(middleware.Timeout(server.requestTimeout))
+	}
+
+	api.Mount("/api/auth/kinopub", server.kinopubAuth.Handler())
+	api.Mount("/api/search", server.search.Handler())
+	api.Mount("/api/bookmarks", server.bookmarks.Handler())
+	api.Mount("/api/discover", server.discover.Handler())
+	api.Mount("/api/stream", server.streams.Handler())
+	api.Mount("/api/links", server.links.Handler())
+	api.Mount("/api/system", server.system.Handler())
+
+	api.Group(server.infoService.Handler())
+	api.Group(server.feedService.Handler())
+	api.Group(server.warmUp.Handler())
 
 	router.Group(server.embeddedPlayer.Handler())
 
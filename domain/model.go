@@ -5,12 +5,15 @@ import (
 )
 
 type Movie struct {
-	UID          string `json:"uid,omitempty"`
-	Title        string `json:"title,omitempty"`
-	Year         int    `json:"year,omitempty"`
-	Overview     string `json:"overview,omitempty"`
-	PosterPath   string `json:"poster_path,omitempty"`
-	BackdropPath string `json:"backdrop_path,omitempty"`
+	UID          string       `json:"uid,omitempty"`
+	Title        string       `json:"title,omitempty"`
+	Year         int          `json:"year,omitempty"`
+	Overview     string       `json:"overview,omitempty"`
+	PosterPath   string       `json:"poster_path,omitempty"`
+	BackdropPath string       `json:"backdrop_path,omitempty"`
+	Files        []File       `json:"files,omitempty"`
+	Subtitles    []Subtitle   `json:"subtitles,omitempty"`
+	AudioTracks  []AudioTrack `json:"audio_tracks,omitempty"`
 }
 
 type Series struct {
@@ -24,12 +27,13 @@ type Series struct {
 }
 
 type Season struct {
-	UID        string    `json:"uid,omitempty"`
-	Name       string    `json:"name,omitempty"`
-	Number     int       `json:"number,omitempty"`
-	AirDate    string    `json:"air_date"`
-	Episodes   []Episode `json:"episodes,omitempty"`
-	PosterPath string    `json:"poster_path,omitempty"`
+	UID         string    `json:"uid,omitempty"`
+	Name        string    `json:"name,omitempty"`
+	Number      int       `json:"number,omitempty"`
+	AirDate     string    `json:"air_date"`
+	Episodes    []Episode `json:"episodes,omitempty"`
+	PosterPath  string    `json:"poster_path,omitempty"`
+	WatchStatus string    `json:"watch_status,omitempty"`
 }
 
 type Episode struct {
@@ -41,17 +45,68 @@ type Episode struct {
 	FirstAired time.Time `json:"first_aired,omitempty"`
 	Files      []File    `json:"files,omitempty"`
 	StillPath  string    `json:"still_path,omitempty"`
+	Thumbnail  string    `json:"thumbnail,omitempty"`
+	// Duration in seconds
+	Duration    int    `json:"duration,omitempty"`
+	WatchStatus string `json:"watch_status,omitempty"`
+	// ResumePosition in seconds to continue watching from
+	ResumePosition int          `json:"resume_position,omitempty"`
+	Subtitles      []Subtitle   `json:"subtitles,omitempty"`
+	AudioTracks    []AudioTrack `json:"audio_tracks,omitempty"`
+}
+
+// Stream is the video file selected to play
+type Stream struct {
+	URL     string `json:"url"`
+	Format  string `json:"format"`
+	Quality string `json:"quality,omitempty"`
+	Height  int    `json:"height,omitempty"`
+	Codec   string `json:"codec,omitempty"`
+	// AudioTrack to switch to, if the stream has several ones
+	AudioTrack *AudioTrack `json:"audio_track,omitempty"`
+	Profile    string      `json:"profile"`
+}
+
+// Subtitle track of the video
+type Subtitle struct {
+	Lang string `json:"lang"`
+	URL  string `json:"url"`
+	// Shift in seconds to sync the subtitles with the video
+	Shift int `json:"shift,omitempty"`
+	// Embedded subtitles are part of the video stream
+	Embedded bool `json:"embedded,omitempty"`
+}
+
+// AudioTrack of the video, e.g. original audio or a voice-over
+type AudioTrack struct {
+	// Index of the track in the video stream
+	Index    int    `json:"index"`
+	Lang     string `json:"lang"`
+	Title    string `json:"title,omitempty"`
+	Codec    string `json:"codec,omitempty"`
+	Channels int    `json:"channels,omitempty"`
 }
 
 type File struct {
 	Quality string `json:"quality"`
-	URL     struct {
+	Width   int    `json:"width,omitempty"`
+	Height  int    `json:"height,omitempty"`
+	// Codec of the video, e.g. h264 or h265
+	Codec string `json:"codec,omitempty"`
+	URL   struct {
 		HTTP string `json:"http"`
 		Hls  string `json:"hls"`
 		Hls4 string `json:"hls4"`
 	} `json:"url"`
 }
 
+// Watching statuses of the episode or season
+const (
+	WatchStatusUnwatched = "UNWATCHED"
+	WatchStatusWatching  = "WATCHING"
+	WatchStatusWatched   = "WATCHED"
+)
+
 const (
 	TypeSerial  = "SERIAL"
 	TypeMovie   = "MOVIE"
@@ -63,4 +118,46 @@ type SearchResult struct {
 	UID        string `json:"uid,omitempty"`
 	Title      string `json:"title,omitempty"`
 	PosterPath string `json:"poster_path,omitempty"`
+	Year       int    `json:"year,omitempty"`
+	// Playable tells whether kinopub has the title
+	Playable bool `json:"playable"`
+}
+
+// BookmarkFolder groups bookmarked items
+type BookmarkFolder struct {
+	ID        int       `json:"id"`
+	Title     string    `json:"title"`
+	Count     int       `json:"count"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Collection is an editorial selection of titles
+type Collection struct {
+	ID         int            `json:"id"`
+	Title      string         `json:"title"`
+	PosterPath string         `json:"poster_path,omitempty"`
+	Items      []SearchResult `json:"items,omitempty"`
+}
+
+// Collections is a single page of the collections list
+type Collections struct {
+	Items      []Collection `json:"items"`
+	Pagination Pagination   `json:"pagination"`
+}
+
+// Pagination describes position of the page in the list
+type Pagination struct {
+	Page       int `json:"page"`
+	Pages      int `json:"pages"`
+	PerPage    int `json:"per_page"`
+	TotalItems int `json:"total_items"`
+}
+
+// SearchResults is a single page of the search results
+type SearchResults struct {
+	Items []SearchResult `json:"items"`
+	// Pagination is the page of kinopub items
+	Pagination Pagination `json:"pagination"`
+	// TMDBPagination is the page of TMDB titles merged with kinopub items, if TMDB has been searched
+	TMDBPagination *Pagination `json:"tmdb_pagination,omitempty"`
 }
@@ -5,7 +5,6 @@ go 1.12
 require (
 	github.com/boltdb/bolt v1.3.1
 	github.com/franela/goblin v0.0.0-20201006155558-6240afcb2eb7 // indirect
-	github.com/franela/goreq v0.0.0-20171204163338-bcd34c9993f8
 	github.com/gin-gonic/gin v1.6.3
 	github.com/go-chi/chi v4.1.2+incompatible
 	github.com/go-chi/render v1.0.1
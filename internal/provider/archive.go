@@ -0,0 +1,168 @@
+package providers
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/pkg/errors"
+)
+
+const (
+	archiveFormat  = "kinohub-cache"
+	archiveVersion = 1
+
+	// importBatchSize is the number of records merged in a single transaction
+	importBatchSize = 500
+)
+
+// archiveHeader is the first record of the archive
+type archiveHeader struct {
+	Format    string    `json:"format"`
+	Version   int       `json:"version"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// archiveRecord is a single cache entry in the archive
+type archiveRecord struct {
+	Cache     string    `json:"cache"`
+	Key       string    `json:"key"`
+	ExpiresAt time.Time `json:"expires_at"`
+	Value     []byte    `json:"value"`
+}
+
+// ImportReport summarizes the result of the cache import
+type ImportReport struct {
+	Imported int `json:"imported"`
+	Skipped  int `json:"skipped"`
+}
+
+// Export writes all the persisted entries to the gzipped stream of JSON records
+// and returns the number of exported entries.
+func (scm *StandardCacheManager) Export(w io.Writer) (int, error) {
+	if scm.store == nil {
+		return 0, errStoreClosed
+	}
+
+	zw := gzip.NewWriter(w)
+	enc := json.NewEncoder(zw)
+
+	err := enc.Encode(archiveHeader{Format: archiveFormat, Version: archiveVersion, CreatedAt: time.Now()})
+	if err != nil {
+		return 0, err
+	}
+
+	exported := 0
+	err = scm.store.View(func(tx *bolt.Tx) error {
+		return tx.ForEach(func(name []byte, bucket *bolt.Bucket) error {
+			return bucket.ForEach(func(k, v []byte) error {
+				env := &envelope{}
+				if err := env.UnmarshalBinary(v); err != nil {
+					// records of the outdated format are not worth to export
+					return nil
+				}
+
+				exported++
+				return enc.Encode(archiveRecord{
+					Cache:     string(name),
+					Key:       string(k),
+					ExpiresAt: env.expiresAt,
+					Value:     env.data,
+				})
+			})
+		})
+	})
+
+	if err != nil {
+		return 0, errors.WithMessage(err, "Cannot export cache")
+	}
+
+	return exported, zw.Close()
+}
+
+// Import merges entries from the archive into the cache. Entries are replaced
+// only if the archived ones expire later.
+func (scm *StandardCacheManager) Import(r io.Reader) (*ImportReport, error) {
+	if scm.store == nil {
+		return nil, errStoreClosed
+	}
+
+	zr, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, errors.WithMessage(err, "Invalid cache archive")
+	}
+	defer zr.Close()
+
+	dec := json.NewDecoder(zr)
+
+	header := archiveHeader{}
+	if err = dec.Decode(&header); err != nil {
+		return nil, errors.WithMessage(err, "Invalid cache archive")
+	}
+
+	if header.Format != archiveFormat || header.Version > archiveVersion {
+		return nil, errors.Errorf("Unsupported cache archive: %s v%d", header.Format, header.Version)
+	}
+
+	report := &ImportReport{}
+	batch := make([]archiveRecord, 0, importBatchSize)
+	for {
+		rec := archiveRecord{}
+		err = dec.Decode(&rec)
+		if err != nil && err != io.EOF {
+			return report, errors.WithMessage(err, "Cannot read cache archive")
+		}
+
+		if err == nil {
+			batch = append(batch, rec)
+		}
+
+		if len(batch) == importBatchSize || (err == io.EOF && len(batch) > 0) {
+			if merr := scm.mergeRecords(batch, report); merr != nil {
+				return report, errors.WithMessage(merr, "Cannot import cache")
+			}
+			batch = batch[:0]
+		}
+
+		if err == io.EOF {
+			return report, nil
+		}
+	}
+}
+
+func (scm *StandardCacheManager) mergeRecords(records []archiveRecord, report *ImportReport) error {
+	return scm.store.Update(func(tx *bolt.Tx) error {
+		for _, rec := range records {
+			bucket, err := tx.CreateBucketIfNotExists([]byte(rec.Cache))
+			if err != nil {
+				return err
+			}
+
+			current := &envelope{}
+			if v := bucket.Get([]byte(rec.Key)); v != nil && current.UnmarshalBinary(v) == nil &&
+				!current.expiresAt.Before(rec.ExpiresAt) {
+				report.Skipped++
+				continue
+			}
+
+			data, _ := (&envelope{expiresAt: rec.ExpiresAt, data: rec.Value}).MarshalBinary()
+			if err = bucket.Put([]byte(rec.Key), data); err != nil {
+				return err
+			}
+			report.Imported++
+		}
+
+		return nil
+	})
+}
+
+// Close releases the cache database
+func (scm *StandardCacheManager) Close() error {
+	if scm.store == nil {
+		return nil
+	}
+
+	return scm.store.Close()
+}
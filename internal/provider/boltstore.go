@@ -0,0 +1,153 @@
+package providers
+
+import (
+	"os"
+	"sync"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/pkg/errors"
+)
+
+var errStoreClosed = errors.New("cache database is closed")
+
+// renameFile replaces the database file with the compacted copy. Tests replace it to simulate failures.
+var renameFile = os.Rename
+
+// boltStore guards access to the bolt database so the file can be replaced during compaction
+type boltStore struct {
+	mu   sync.RWMutex
+	db   *bolt.DB
+	path string
+}
+
+func openBoltStore(path string) (*boltStore, error) {
+	if err := ensureFileExists(path); err != nil {
+		return nil, err
+	}
+
+	db, err := openBoltDB(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return &boltStore{db: db, path: path}, nil
+}
+
+func openBoltDB(path string) (*bolt.DB, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: 10 * time.Second})
+	if err != nil {
+		return nil, errors.WithMessage(err, "Can't open cache")
+	}
+
+	return db, nil
+}
+
+func (s *boltStore) View(fn func(tx *bolt.Tx) error) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.db == nil {
+		return errStoreClosed
+	}
+
+	return s.db.View(fn)
+}
+
+func (s *boltStore) Update(fn func(tx *bolt.Tx) error) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.db == nil {
+		return errStoreClosed
+	}
+
+	return s.db.Update(fn)
+}
+
+// FileSize returns size of the database file on disk
+func (s *boltStore) FileSize() (int64, error) {
+	fi, err := os.Stat(s.path)
+	if err != nil {
+		return 0, err
+	}
+
+	return fi.Size(), nil
+}
+
+// Compact rewrites the database into a new file to give the space of deleted
+// entries back to the file system. Bolt never shrinks the file by itself.
+func (s *boltStore) Compact() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.db == nil {
+		return errStoreClosed
+	}
+
+	tmpPath := s.path + ".compact"
+	os.Remove(tmpPath)
+
+	dst, err := openBoltDB(tmpPath)
+	if err != nil {
+		return err
+	}
+
+	err = s.db.View(func(tx *bolt.Tx) error {
+		return tx.ForEach(func(name []byte, bucket *bolt.Bucket) error {
+			return dst.Update(func(dtx *bolt.Tx) error {
+				nb, err := dtx.CreateBucketIfNotExists(name)
+				if err != nil {
+					return err
+				}
+				// keys are copied in order, so pages can be filled completely
+				nb.FillPercent = 1.0
+
+				return bucket.ForEach(func(k, v []byte) error {
+					return nb.Put(k, v)
+				})
+			})
+		})
+	})
+
+	if err != nil {
+		dst.Close()
+		os.Remove(tmpPath)
+		return errors.WithMessage(err, "Cannot copy cache database")
+	}
+
+	// the copy replaces the file while the database is still open, so the store
+	// keeps working with the original one if the file can't be replaced
+	if err = renameFile(tmpPath, s.path); err != nil {
+		cerr := dst.Close()
+		os.Remove(tmpPath)
+
+		if cerr != nil {
+			return errors.Errorf("Cannot replace cache database: %s; cannot close compacted copy: %s", err.Error(), cerr.Error())
+		}
+		return errors.Wrap(err, "Cannot replace cache database")
+	}
+
+	old := s.db
+	s.db = dst
+
+	if err = old.Close(); err != nil {
+		return errors.WithMessage(err, "Cannot close replaced cache database")
+	}
+
+	return nil
+}
+
+// Close closes the database
+func (s *boltStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.db == nil {
+		return nil
+	}
+
+	err := s.db.Close()
+	s.db = nil
+	return err
+}
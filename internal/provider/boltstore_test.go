@@ -0,0 +1,60 @@
+package providers
+
+import (
+	"errors"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestBoltStore_CompactRenameFails(t *testing.T) {
+	scm, cleanup := newTestCacheManager(t, CacheOptions{})
+	defer cleanup()
+
+	cache := scm.Get("test", time.Hour)
+	if err := cache.Save("key", &testEntry{data: []byte("value")}); err != nil {
+		t.Fatal(err)
+	}
+
+	renameFile = func(from, to string) error { return errors.New("file system is read-only") }
+	defer func() { renameFile = os.Rename }()
+
+	if err := scm.store.Compact(); err == nil {
+		t.Fatalf("Expected compaction to fail")
+	}
+
+	if _, err := os.Stat(scm.store.path + ".compact"); !os.IsNotExist(err) {
+		t.Errorf("Expected compacted copy to be removed: %v", err)
+	}
+
+	// the store keeps working with the original file
+	if !persisted(scm, "test", "key") {
+		t.Errorf("Expected entry to survive failed compaction")
+	}
+
+	if err := cache.Save("other", &testEntry{data: []byte("other")}); err != nil || !persisted(scm, "test", "other") {
+		t.Errorf("Expected database to be writable after failed compaction: %v", err)
+	}
+}
+
+func TestBoltStore_Compact(t *testing.T) {
+	scm, cleanup := newTestCacheManager(t, CacheOptions{})
+	defer cleanup()
+
+	cache := scm.Get("test", time.Hour)
+	if err := cache.Save("key", &testEntry{data: []byte("value")}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := scm.store.Compact(); err != nil {
+		t.Fatalf("Unexpected compaction error: %v", err)
+	}
+
+	if !persisted(scm, "test", "key") {
+		t.Errorf("Expected entry to be copied")
+	}
+
+	if err := cache.Save("other", &testEntry{data: []byte("other")}); err != nil || !persisted(scm, "test", "other") {
+		t.Errorf("Expected compacted database to be writable: %v", err)
+	}
+}
@@ -2,8 +2,11 @@ package providers
 
 import (
 	"bytes"
+	"encoding/binary"
 	"encoding/json"
 	"fmt"
+	"sort"
+	"sync"
 	"time"
 
 	"github.com/boltdb/bolt"
@@ -11,30 +14,101 @@ import (
 	"github.com/sirupsen/logrus"
 )
 
-func NewCacheFactory(path string, logger *logrus.Logger) (CacheFactory, error) {
-	err := ensureFileExists(path + "cache.db")
+// CacheOptions holds limits applied to the caches created by the factory
+type CacheOptions struct {
+	// MemoryMaxEntries limits number of entries kept in memory per named cache. Zero means no limit.
+	MemoryMaxEntries int
+	// MemoryMaxBytes limits size of entries kept in memory per named cache. Zero means no limit.
+	MemoryMaxBytes int64
+	// SweepInterval defines how often expired entries are removed from disk. Zero disables the sweeper.
+	SweepInterval time.Duration
+	// MaxFileSize limits size of the cache database file. Zero means no limit.
+	MaxFileSize int64
+	// StaleWhileRevalidate defines how long after expiration an entry is served while it's refreshed in background.
+	StaleWhileRevalidate time.Duration
+	// StaleIfError defines how long after expiration an entry is served when the remote service fails.
+	StaleIfError time.Duration
+	// Policies overrides defaults of the named caches
+	Policies map[string]CachePolicy
+}
+
+// retention returns how long the entry is kept after expiration
+func (opts CacheOptions) retention() time.Duration {
+	if opts.StaleWhileRevalidate > opts.StaleIfError {
+		return opts.StaleWhileRevalidate
+	}
+	return opts.StaleIfError
+}
+
+// NewCacheFactory returns cache factory backed by the cache database in the provided folder.
+// If the database cannot be opened, the factory keeps entries in memory only.
+func NewCacheFactory(path string, opts CacheOptions, logger *logrus.Logger) CacheFactory {
+	scm, err := OpenCacheManager(path, opts, logger)
 	if err != nil {
-		return nil, err
+		logger.WithField("prefix", "cache").Errorf("Falling back to in-memory cache. %s", err.Error())
+		return newCacheManager(nil, opts, logger)
+	}
+
+	if opts.SweepInterval > 0 {
+		go scm.runSweeper(opts.SweepInterval)
 	}
 
-	db, err := bolt.Open(path+"cache.db", 0600, &bolt.Options{Timeout: 10 * time.Second})
+	return scm
+}
+
+// OpenCacheManager opens the cache database in the provided folder
+func OpenCacheManager(path string, opts CacheOptions, logger *logrus.Logger) (*StandardCacheManager, error) {
+	store, err := openBoltStore(path + "cache.db")
 	if err != nil {
-		return nil, errors.WithMessage(err, "Can't open cache")
+		return nil, err
 	}
 
+	return newCacheManager(store, opts, logger), nil
+}
+
+func newCacheManager(store *boltStore, opts CacheOptions, logger *logrus.Logger) *StandardCacheManager {
 	return &StandardCacheManager{
-		db:     db,
+		store:  store,
+		opts:   opts,
+		memory: make(map[string]*lruCache),
 		logger: logger.WithFields(logrus.Fields{"prefix": "cache"}),
-	}, nil
+	}
 }
 
+// ErrCacheNotFound is returned by administrative operations on unknown caches.
+var ErrCacheNotFound = errors.New("cache not found")
+
 type CacheFactory interface {
+	CacheAdmin
+
 	Get(cacheName string, ttl time.Duration) Cache
 }
 
+// CacheAdmin provides maintenance operations over all the named caches.
+type CacheAdmin interface {
+	// Stats returns size information for every named cache.
+	Stats() ([]CacheStats, error)
+	// Purge removes all entries of the named cache.
+	Purge(cacheName string) error
+	// PurgeKey removes single entry of the named cache.
+	PurgeKey(cacheName string, key string) error
+	// PurgeAll removes all entries of all caches.
+	PurgeAll() error
+	// Sweep removes expired entries and keeps the cache within the size limit.
+	Sweep() (*SweepReport, error)
+}
+
+// CacheStats describes the content of a single named cache.
+type CacheStats struct {
+	Name    string       `json:"name"`
+	Entries int          `json:"entries"`
+	Bytes   int64        `json:"bytes"`
+	Memory  *MemoryStats `json:"memory,omitempty"`
+}
+
 type Cache interface {
-	Save(key string, value CacheEntry)
-	Load(key string, value CacheEntry) bool
+	Save(key string, value CacheEntry) error
+	Load(key string, value CacheEntry) (bool, error)
 }
 
 type CacheEntry interface {
@@ -58,39 +132,235 @@ func Cacheable(m interface{}) CacheEntry {
 	return &cacheable{entry: &m}
 }
 
+// StandardCacheManager keeps recently used entries in memory and persists all of them
+// to the cache database. Without the database entries are kept in memory only.
 type StandardCacheManager struct {
 	logger *logrus.Entry
-	db     *bolt.DB
+	store  *boltStore
+	opts   CacheOptions
+
+	mu     sync.Mutex
+	memory map[string]*lruCache
+
+	sweepMu sync.Mutex
+}
+
+// memoryTier returns in-memory cache shared by all the users of the named cache
+func (scm *StandardCacheManager) memoryTier(cacheName string) *lruCache {
+	scm.mu.Lock()
+	defer scm.mu.Unlock()
+
+	mc, ok := scm.memory[cacheName]
+	if !ok {
+		maxEntries := scm.opts.MemoryMaxEntries
+		if policy := scm.opts.Policies[cacheName]; policy.MaxEntries > 0 {
+			maxEntries = policy.MaxEntries
+		}
+
+		mc = newLRUCache(maxEntries, scm.opts.MemoryMaxBytes)
+		scm.memory[cacheName] = mc
+	}
+
+	return mc
+}
+
+// memoryTiers returns snapshot of all in-memory caches created so far
+func (scm *StandardCacheManager) memoryTiers() map[string]*lruCache {
+	scm.mu.Lock()
+	defer scm.mu.Unlock()
+
+	tiers := make(map[string]*lruCache, len(scm.memory))
+	for name, mc := range scm.memory {
+		tiers[name] = mc
+	}
+
+	return tiers
 }
 
+// Get returns the named cache. Provided TTL is used unless it's overridden by the cache policy.
 func (scm *StandardCacheManager) Get(cacheName string, ttl time.Duration) Cache {
+	policy := scm.opts.Policies[cacheName]
+	if policy.NoCache {
+		return noCache{name: cacheName}
+	}
+
+	if policy.TTL > 0 {
+		ttl = policy.TTL
+	}
+
+	tiers := []Cache{scm.memoryTier(cacheName)}
+	if scm.store != nil {
+		tiers = append(tiers, &boltCache{
+			store:     scm.store,
+			cacheName: cacheName,
+			logger:    scm.logger,
+		})
+	}
+
 	return &expirableCache{
-		ttl:    ttl,
-		logger: scm.logger,
-		cache: &multicastCache{
-			caches: []Cache{
-				&inMemoryCache{cache: make(map[string][]byte)},
-				&boltCache{
-					db:        scm.db,
-					cacheName: cacheName,
-					logger:    scm.logger,
-				},
-			},
-		},
+		name:                 cacheName,
+		ttl:                  ttl,
+		staleWhileRevalidate: scm.opts.StaleWhileRevalidate,
+		staleIfError:         scm.opts.StaleIfError,
+		logger:               scm.logger,
+		cache:                &multicastCache{caches: tiers},
+	}
+}
+
+// Stats returns number of entries and their size for every bucket of the cache database.
+func (scm *StandardCacheManager) Stats() ([]CacheStats, error) {
+	stats := make([]CacheStats, 0)
+
+	if scm.store == nil {
+		return scm.memoryStats(stats), nil
+	}
+
+	err := scm.store.View(func(tx *bolt.Tx) error {
+		return tx.ForEach(func(name []byte, bucket *bolt.Bucket) error {
+			s := CacheStats{Name: string(name)}
+
+			err := bucket.ForEach(func(k, v []byte) error {
+				s.Entries++
+				s.Bytes += int64(len(k) + len(v))
+				return nil
+			})
+
+			stats = append(stats, s)
+			return err
+		})
+	})
+
+	if err != nil {
+		return nil, errors.WithMessage(err, "Cannot read cache stats")
+	}
+
+	return scm.memoryStats(stats), nil
+}
+
+// memoryStats adds stats of the in-memory tiers to the stats of persisted caches
+func (scm *StandardCacheManager) memoryStats(stats []CacheStats) []CacheStats {
+	tiers := scm.memoryTiers()
+	for i := range stats {
+		if mc, ok := tiers[stats[i].Name]; ok {
+			ms := mc.Stats()
+			stats[i].Memory = &ms
+			delete(tiers, stats[i].Name)
+		}
+	}
+
+	// caches that have not been persisted yet
+	for name, mc := range tiers {
+		ms := mc.Stats()
+		stats = append(stats, CacheStats{Name: name, Memory: &ms})
+	}
+
+	sort.Slice(stats, func(i, j int) bool { return stats[i].Name < stats[j].Name })
+
+	return stats
+}
+
+// Purge clears the named cache in memory and drops its bucket. ErrCacheNotFound is
+// returned only if the cache is in neither of them.
+func (scm *StandardCacheManager) Purge(cacheName string) error {
+	scm.logger.Infof("Purging cache [%s]", cacheName)
+
+	mc, ok := scm.memoryTiers()[cacheName]
+	if ok {
+		mc.Clear()
+	}
+
+	if scm.store == nil {
+		if !ok {
+			return ErrCacheNotFound
+		}
+		return nil
+	}
+
+	return scm.store.Update(func(tx *bolt.Tx) error {
+		err := tx.DeleteBucket([]byte(cacheName))
+		if err == bolt.ErrBucketNotFound {
+			if ok {
+				return nil
+			}
+			return ErrCacheNotFound
+		}
+		return err
+	})
+}
+
+// PurgeKey removes the entry from the named cache in memory and on disk. ErrCacheNotFound is
+// returned only if the cache is in neither of them.
+func (scm *StandardCacheManager) PurgeKey(cacheName string, key string) error {
+	scm.logger.Infof("Purging key [%s] of cache [%s]", key, cacheName)
+
+	mc, ok := scm.memoryTiers()[cacheName]
+	if ok {
+		mc.Delete(key)
 	}
+
+	if scm.store == nil {
+		if !ok {
+			return ErrCacheNotFound
+		}
+		return nil
+	}
+
+	return scm.store.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(cacheName))
+		if bucket == nil {
+			if ok {
+				return nil
+			}
+			return ErrCacheNotFound
+		}
+
+		return bucket.Delete([]byte(key))
+	})
+}
+
+// PurgeAll drops all the buckets of the cache database.
+func (scm *StandardCacheManager) PurgeAll() error {
+	scm.logger.Infoln("Purging all caches")
+
+	for _, mc := range scm.memoryTiers() {
+		mc.Clear()
+	}
+
+	if scm.store == nil {
+		return nil
+	}
+
+	return scm.store.Update(func(tx *bolt.Tx) error {
+		names := make([][]byte, 0)
+		err := tx.ForEach(func(name []byte, _ *bolt.Bucket) error {
+			names = append(names, append([]byte{}, name...))
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, name := range names {
+			if err := tx.DeleteBucket(name); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
 }
 
 type boltCache struct {
-	db        *bolt.DB
+	store     *boltStore
 	cacheName string
 	logger    *logrus.Entry
 }
 
 // Save new value to the cache using provided key
-func (c *boltCache) Save(key string, value CacheEntry) {
+func (c *boltCache) Save(key string, value CacheEntry) error {
 	c.logger.Debugf("Saving value to cache [%s] using [%s] key", c.cacheName, key)
 
-	err := c.db.Update(func(tx *bolt.Tx) error {
+	err := c.store.Update(func(tx *bolt.Tx) error {
 
 		bucket, err := tx.CreateBucketIfNotExists([]byte(c.cacheName))
 		if err != nil {
@@ -109,18 +379,16 @@ func (c *boltCache) Save(key string, value CacheEntry) {
 		return bucket.Put([]byte(key), buf)
 	})
 
-	if err != nil {
-		panic(err.Error())
-	}
+	return errors.WithMessagef(err, "Cannot save [%s] to cache [%s]", key, c.cacheName)
 }
 
 // Load value by key from the specified cache
-func (c *boltCache) Load(key string, value CacheEntry) bool {
+func (c *boltCache) Load(key string, value CacheEntry) (bool, error) {
 	c.logger.Debugf("Load value from cache [%s] using [%s] key", c.cacheName, key)
 
 	var loaded bool
 
-	err := c.db.View(func(tx *bolt.Tx) error {
+	err := c.store.View(func(tx *bolt.Tx) error {
 
 		bucket := tx.Bucket([]byte(c.cacheName))
 		if bucket == nil {
@@ -132,8 +400,13 @@ func (c *boltCache) Load(key string, value CacheEntry) bool {
 		key := []byte(key)
 		for k, v := cur.Seek(key); bytes.Equal(k, key); k, v = cur.Next() {
 			c.logger.Debugln("Unmarshaling cache value")
+			if err := value.UnmarshalBinary(v); err != nil {
+				// records of the outdated format are treated as missing
+				c.logger.Debugf("Cannot unmarshal cache value: %s", err)
+				return nil
+			}
 			loaded = true
-			return value.UnmarshalBinary(v)
+			return nil
 		}
 
 		c.logger.Debugln("No element in cache with provided key")
@@ -141,87 +414,135 @@ func (c *boltCache) Load(key string, value CacheEntry) bool {
 	})
 
 	if err != nil {
-		panic(err.Error())
+		return false, errors.WithMessagef(err, "Cannot load [%s] from cache [%s]", key, c.cacheName)
 	}
 
-	return loaded
+	return loaded, nil
 }
 
-type expirableCache struct {
-	ttl    time.Duration
-	cache  Cache
-	logger *logrus.Entry
-}
+// envelopeVersion marks the layout of the envelope record
+const envelopeVersion byte = 1
 
-func (c *expirableCache) Save(key string, value CacheEntry) {
-	c.logger.Debugf("Saving expirable item. Key: %s Now: %s", key, time.Now())
-	// save experation
-	c.cache.Save("_CREATED_AT_:"+key, Cacheable(time.Now()))
-	// save data
-	c.cache.Save(key, value)
-}
+// envelopeHeaderSize is the size of version byte followed by expiration time in unix nanoseconds
+const envelopeHeaderSize = 9
+
+var errInvalidEnvelope = errors.New("invalid cache envelope")
 
-func (c *expirableCache) Load(key string, value CacheEntry) bool {
-	c.logger.Debugln("Loading from expirable cache")
+// envelope stores cached value together with its expiration time in a single record
+type envelope struct {
+	expiresAt time.Time
+	data      []byte
+}
 
-	createdAt := &time.Time{}
-	c.cache.Load("_CREATED_AT_:"+key, Cacheable(createdAt))
+func (e *envelope) MarshalBinary() (data []byte, err error) {
+	buf := make([]byte, envelopeHeaderSize, envelopeHeaderSize+len(e.data))
+	buf[0] = envelopeVersion
+	binary.BigEndian.PutUint64(buf[1:], uint64(e.expiresAt.UnixNano()))
+	return append(buf, e.data...), nil
+}
 
-	c.logger.Debugf("Created at: [%v]", createdAt)
-	if createdAt.Add(c.ttl).Before(time.Now()) {
-		c.logger.Debugln("Item has been expired.")
-		return false
+func (e *envelope) UnmarshalBinary(data []byte) error {
+	if len(data) < envelopeHeaderSize || data[0] != envelopeVersion {
+		return errInvalidEnvelope
 	}
 
-	return c.cache.Load(key, value)
+	e.expiresAt = time.Unix(0, int64(binary.BigEndian.Uint64(data[1:envelopeHeaderSize])))
+	e.data = append([]byte{}, data[envelopeHeaderSize:]...)
+	return nil
 }
 
-type inMemoryCache struct {
-	cache map[string][]byte
+func (e *envelope) Expired() bool {
+	return e.expiresAt.Before(time.Now())
 }
 
-func (c *inMemoryCache) Save(key string, value CacheEntry) {
+type expirableCache struct {
+	name                 string
+	ttl                  time.Duration
+	staleWhileRevalidate time.Duration
+	staleIfError         time.Duration
+	cache                Cache
+	logger               *logrus.Entry
+}
+
+func (c *expirableCache) Save(key string, value CacheEntry) error {
 	data, err := value.MarshalBinary()
 	if err != nil {
-		panic(err.Error())
+		return errors.WithMessage(err, "Cannot marshal value to cache")
 	}
 
-	c.cache[key] = data
+	return c.cache.Save(key, &envelope{expiresAt: time.Now().Add(c.ttl), data: data})
 }
 
-func (c *inMemoryCache) Load(key string, value CacheEntry) bool {
-	if data, ok := c.cache[key]; ok {
-		err := value.UnmarshalBinary(data)
-		if err != nil {
-			return false
-		}
+func (c *expirableCache) Load(key string, value CacheEntry) (bool, error) {
+	env, found, err := c.loadEnvelope(key)
+	if !found {
+		return false, err
+	}
+
+	if env.Expired() {
+		c.logger.Debugf("Item [%s] has been expired at %s", key, env.expiresAt)
+		return false, nil
+	}
 
-		return true
+	if err := value.UnmarshalBinary(env.data); err != nil {
+		return false, errors.WithMessage(err, "Cannot unmarshal cached value")
 	}
 
-	return false
+	return true, nil
+}
+
+// loadEnvelope loads the entry regardless of its expiration
+func (c *expirableCache) loadEnvelope(key string) (*envelope, bool, error) {
+	env := &envelope{}
+	found, err := c.cache.Load(key, env)
+	return env, found, err
+}
+
+func (c *expirableCache) canRevalidate(env *envelope) bool {
+	return env.expiresAt.Add(c.staleWhileRevalidate).After(time.Now())
+}
+
+func (c *expirableCache) canServeOnError(env *envelope) bool {
+	return env.expiresAt.Add(c.staleIfError).After(time.Now())
 }
 
 type multicastCache struct {
 	caches []Cache
 }
 
-func (c *multicastCache) Save(key string, value CacheEntry) {
+// Save stores value to all the caches and returns the first error
+func (c *multicastCache) Save(key string, value CacheEntry) error {
+	var saveErr error
 	for _, cache := range c.caches {
-		cache.Save(key, value)
+		if err := cache.Save(key, value); err != nil && saveErr == nil {
+			saveErr = err
+		}
 	}
+
+	return saveErr
 }
 
-func (c *multicastCache) Load(key string, value CacheEntry) bool {
+// Load returns value from the first cache that has it. Failed caches are skipped,
+// their error is returned only if none of the caches has the value.
+func (c *multicastCache) Load(key string, value CacheEntry) (bool, error) {
+	var loadErr error
 	for index, cache := range c.caches {
-		if cache.Load(key, value) {
-			// persist data to the first cache
-			if index == 0 && cache != c.caches[index] {
-				c.caches[index].Save(key, value)
+		found, err := cache.Load(key, value)
+		if err != nil {
+			if loadErr == nil {
+				loadErr = err
+			}
+			continue
+		}
+
+		if found {
+			// promote data to the faster caches
+			for _, upper := range c.caches[:index] {
+				upper.Save(key, value)
 			}
-			return true
+			return true, nil
 		}
 	}
 
-	return false
+	return false, loadErr
 }
@@ -0,0 +1,210 @@
+package providers
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/sirupsen/logrus"
+)
+
+func newTestCacheManager(t *testing.T, opts CacheOptions) (*StandardCacheManager, func()) {
+	dir, err := ioutil.TempDir("", "kinohub-cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	scm, err := OpenCacheManager(dir+"/", opts, logrus.New())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return scm, func() { os.RemoveAll(dir) }
+}
+
+func persisted(scm *StandardCacheManager, cacheName, key string) bool {
+	found := false
+	scm.store.View(func(tx *bolt.Tx) error {
+		if bucket := tx.Bucket([]byte(cacheName)); bucket != nil {
+			found = bucket.Get([]byte(key)) != nil
+		}
+		return nil
+	})
+	return found
+}
+
+func TestExpirableCache_Envelope(t *testing.T) {
+	scm, cleanup := newTestCacheManager(t, CacheOptions{})
+	defer cleanup()
+
+	scm.Get("fresh", time.Hour).Save("key", &testEntry{data: []byte("value")})
+	scm.Get("expired", -time.Hour).Save("key", &testEntry{data: []byte("value")})
+
+	e := &testEntry{}
+	if !loaded(scm.Get("fresh", time.Hour), "key", e) || string(e.data) != "value" {
+		t.Errorf("Expected fresh value, got: %s", e.data)
+	}
+
+	if loaded(scm.Get("expired", time.Hour), "key", &testEntry{}) {
+		t.Errorf("Expected expired value to be missing")
+	}
+
+	stats, err := scm.Stats()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, s := range stats {
+		if s.Entries != 1 {
+			t.Errorf("Expected single record per entry in [%s], got %d", s.Name, s.Entries)
+		}
+	}
+}
+
+func TestStandardCacheManager_Sweep(t *testing.T) {
+	scm, cleanup := newTestCacheManager(t, CacheOptions{})
+	defer cleanup()
+
+	scm.Get("test", time.Hour).Save("fresh", &testEntry{data: []byte("value")})
+	scm.Get("test", -time.Hour).Save("expired", &testEntry{data: []byte("value")})
+
+	// record written in the format without envelope
+	err := scm.store.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte("test")).Put([]byte("_CREATED_AT_:fresh"), []byte(`"2019-01-01T00:00:00Z"`))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := scm.Sweep()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if report.Expired != 2 || report.Evicted != 0 {
+		t.Errorf("Unexpected sweep report: %+v", report)
+	}
+
+	if !persisted(scm, "test", "fresh") || persisted(scm, "test", "expired") {
+		t.Errorf("Expected only fresh value to survive the sweep")
+	}
+}
+
+func TestStandardCacheManager_SweepSizeLimit(t *testing.T) {
+	scm, cleanup := newTestCacheManager(t, CacheOptions{MaxFileSize: 1 << 20})
+	defer cleanup()
+
+	payload := make([]byte, 1024)
+	for i := 0; i < 2000; i++ {
+		ttl := time.Duration(i+1) * time.Minute
+		scm.Get("test", ttl).Save(fmt.Sprintf("key-%d", i), &testEntry{data: payload})
+	}
+
+	report, err := scm.Sweep()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if report.Evicted == 0 || !report.Compacted {
+		t.Errorf("Expected cache to be shrunk: %+v", report)
+	}
+
+	if report.FileSize > 1<<20 {
+		t.Errorf("Cache exceeds the limit after sweep: %d", report.FileSize)
+	}
+
+	// entries that expire soonest are evicted first
+	if persisted(scm, "test", "key-0") || !persisted(scm, "test", "key-1999") {
+		t.Errorf("Expected the longest living entry to be kept")
+	}
+}
+
+func TestNewCacheFactory_FallsBackToMemory(t *testing.T) {
+	cf := NewCacheFactory("/nonexistent/kinohub/", CacheOptions{}, logrus.New())
+
+	cache := cf.Get("test", time.Hour)
+	if err := cache.Save("key", &testEntry{data: []byte("value")}); err != nil {
+		t.Fatal(err)
+	}
+
+	e := &testEntry{}
+	if !loaded(cache, "key", e) || string(e.data) != "value" {
+		t.Errorf("Expected value from memory, got: %s", e.data)
+	}
+
+	if err := cf.Purge("test"); err != nil {
+		t.Errorf("Unexpected purge error: %s", err)
+	}
+
+	if loaded(cache, "key", &testEntry{}) {
+		t.Errorf("Expected value to be purged")
+	}
+}
+
+func TestStandardCacheManager_ExportImport(t *testing.T) {
+	src, cleanupSrc := newTestCacheManager(t, CacheOptions{})
+	defer cleanupSrc()
+
+	src.Get("test", time.Hour).Save("fresh", &testEntry{data: []byte("exported")})
+	src.Get("test", time.Hour).Save("outdated", &testEntry{data: []byte("exported")})
+
+	buf := &bytes.Buffer{}
+	n, err := src.Export(buf)
+	if err != nil || n != 2 {
+		t.Fatalf("Unexpected export result: %d, %v", n, err)
+	}
+
+	dst, cleanupDst := newTestCacheManager(t, CacheOptions{})
+	defer cleanupDst()
+
+	// local entry that expires later than archived one must be kept
+	dst.Get("test", 2*time.Hour).Save("outdated", &testEntry{data: []byte("local")})
+
+	report, err := dst.Import(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if report.Imported != 1 || report.Skipped != 1 {
+		t.Errorf("Unexpected import report: %+v", report)
+	}
+
+	e := &testEntry{}
+	if !loaded(dst.Get("test", time.Hour), "fresh", e) || string(e.data) != "exported" {
+		t.Errorf("Expected imported value, got: %s", e.data)
+	}
+
+	if !loaded(dst.Get("test", time.Hour), "outdated", e) || string(e.data) != "local" {
+		t.Errorf("Expected local value, got: %s", e.data)
+	}
+}
+
+func TestStandardCacheManager_PurgeMemoryOnly(t *testing.T) {
+	scm, cleanup := newTestCacheManager(t, CacheOptions{})
+	defer cleanup()
+
+	// nothing has been saved, so the cache has no bucket yet
+	if loaded(scm.Get("test", time.Hour), "key", &testEntry{}) {
+		t.Fatalf("Unexpected value in the empty cache")
+	}
+
+	if err := scm.PurgeKey("test", "key"); err != nil {
+		t.Errorf("Unexpected purge key error: %v", err)
+	}
+
+	if err := scm.Purge("test"); err != nil {
+		t.Errorf("Unexpected purge error: %v", err)
+	}
+
+	if err := scm.Purge("missing"); err != ErrCacheNotFound {
+		t.Errorf("Purge() error = %v, want %v", err, ErrCacheNotFound)
+	}
+
+	if err := scm.PurgeKey("missing", "key"); err != ErrCacheNotFound {
+		t.Errorf("PurgeKey() error = %v, want %v", err, ErrCacheNotFound)
+	}
+}
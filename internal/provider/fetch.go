@@ -0,0 +1,156 @@
+package providers
+
+import (
+	"context"
+
+	httpu "github.com/dpfg/kinohub-core/pkg/http"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// Loader fetches a fresh value from the remote service
+type Loader func(ctx context.Context) (CacheEntry, error)
+
+// inflight coalesces concurrent loads of the same cache entry
+var inflight flightGroup
+
+// RawEntry is a cache entry that holds already marshaled value
+type RawEntry []byte
+
+func (e RawEntry) MarshalBinary() (data []byte, err error) {
+	return e, nil
+}
+
+func (e *RawEntry) UnmarshalBinary(data []byte) error {
+	*e = append((*e)[:0], data...)
+	return nil
+}
+
+// Fetch loads value from the cache. On cache miss the value is loaded
+// by the loader and saved to the cache. Concurrent callers that miss the same
+// entry share a single call to the loader.
+//
+// Entries that have expired recently are served as is while the fresh value is
+// loaded in background (stale-while-revalidate). Older entries are served only
+// when the loader fails (stale-if-error).
+//
+// The context bounds the time the caller waits for the value. The background
+// refresh isn't bound to the context, as it outlives the caller. Serving the stale
+// entry is recorded in the context, so the response can be marked stale.
+func Fetch(ctx context.Context, cache Cache, key string, value CacheEntry, load Loader) error {
+	ec, ok := cache.(*expirableCache)
+	if !ok {
+		if found, _ := cache.Load(key, value); found {
+			return nil
+		}
+
+		id := key
+		if fi, ok := cache.(flightIdentifier); ok {
+			id = fi.flightID(key)
+		}
+		return loadAndSave(ctx, cache, id, key, value, load)
+	}
+
+	env, found, err := ec.loadEnvelope(key)
+	if err != nil {
+		// broken cache must not prevent loading from the remote service
+		ec.logger.Errorf("Cannot load [%s] from cache: %s", ec.flightID(key), err.Error())
+	}
+
+	if found && !env.Expired() {
+		if err := value.UnmarshalBinary(env.data); err == nil {
+			return nil
+		}
+		found = false
+	}
+
+	if found && ec.canRevalidate(env) {
+		ec.logger.Debugf("Serving stale [%s] while revalidating", key)
+		go ec.refresh(key, load)
+
+		httpu.MarkStale(ctx)
+		return value.UnmarshalBinary(env.data)
+	}
+
+	err = loadAndSave(ctx, cache, ec.flightID(key), key, value, load)
+	if err != nil && found && ctx.Err() == nil && ec.canServeOnError(env) {
+		ec.logger.Warnf("Serving stale [%s] due to error: %s", key, err.Error())
+
+		httpu.MarkStale(ctx)
+		return value.UnmarshalBinary(env.data)
+	}
+
+	return err
+}
+
+// loadAndSave loads the value and saves it to the cache. The load is shared
+// with the concurrent callers that use the same flight id.
+func loadAndSave(ctx context.Context, cache Cache, id string, key string, value CacheEntry, load Loader) error {
+	data, err := inflight.Do(ctx, id, func(ctx context.Context) ([]byte, error) {
+		entry, err := load(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		data, err := entry.MarshalBinary()
+		if err != nil {
+			return nil, errors.WithMessage(err, "Cannot marshal loaded value")
+		}
+
+		raw := RawEntry(data)
+		if err := cache.Save(key, &raw); err != nil {
+			logrus.WithField("prefix", "cache").Errorf("Cannot save [%s] to cache: %s", id, err.Error())
+		}
+
+		return data, nil
+	})
+
+	if err != nil {
+		return err
+	}
+
+	return value.UnmarshalBinary(data)
+}
+
+// flightIdentifier is implemented by the caches that can identify their entries among all the caches
+type flightIdentifier interface {
+	flightID(key string) string
+}
+
+// flightID identifies the entry among all the caches
+func (c *expirableCache) flightID(key string) string {
+	return c.name + "/" + key
+}
+
+// refresh reloads the entry in background. Refresh joins the load
+// of the same entry if there is one in-flight.
+func (c *expirableCache) refresh(key string, load Loader) {
+	var data RawEntry
+	if err := loadAndSave(context.Background(), c, c.flightID(key), key, &data, load); err != nil {
+		c.logger.Warnf("Cannot refresh [%s]: %s", c.flightID(key), err.Error())
+	}
+}
+
+// notFoundMarker is saved to the negative caches in place of the value
+var notFoundMarker = RawEntry("{}")
+
+// MarkNotFound remembers that the remote service has nothing for the key
+func MarkNotFound(cache Cache, key string) error {
+	marker := notFoundMarker
+	return cache.Save(key, &marker)
+}
+
+// IsMarkedNotFound tells whether the remote service had nothing for the key recently
+func IsMarkedNotFound(cache Cache, key string) bool {
+	var marker RawEntry
+	found, _ := cache.Load(key, &marker)
+	return found
+}
+
+// Forget removes the entry from the named cache. Missing caches are ignored.
+func Forget(admin CacheAdmin, cacheName string, key string) error {
+	if err := admin.PurgeKey(cacheName, key); err != nil && err != ErrCacheNotFound {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,237 @@
+package providers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	httpu "github.com/dpfg/kinohub-core/pkg/http"
+)
+
+func staticLoader(value string) Loader {
+	return func(ctx context.Context) (CacheEntry, error) {
+		return &testEntry{data: []byte(value)}, nil
+	}
+}
+
+func failingLoader(ctx context.Context) (CacheEntry, error) {
+	return nil, errors.New("service is down")
+}
+
+func TestFetch_MissAndHit(t *testing.T) {
+	scm, cleanup := newTestCacheManager(t, CacheOptions{})
+	defer cleanup()
+
+	e := &testEntry{}
+	if err := Fetch(context.Background(), scm.Get("test", time.Hour), "key", e, staticLoader("loaded")); err != nil || string(e.data) != "loaded" {
+		t.Fatalf("Unexpected result: %s, %v", e.data, err)
+	}
+
+	e = &testEntry{}
+	if err := Fetch(context.Background(), scm.Get("test", time.Hour), "key", e, failingLoader); err != nil || string(e.data) != "loaded" {
+		t.Errorf("Expected value from cache: %s, %v", e.data, err)
+	}
+}
+
+func TestFetch_StaleWhileRevalidate(t *testing.T) {
+	scm, cleanup := newTestCacheManager(t, CacheOptions{StaleWhileRevalidate: time.Hour})
+	defer cleanup()
+
+	scm.Get("test", -time.Minute).Save("key", &testEntry{data: []byte("stale")})
+
+	refreshed := make(chan bool)
+	e := &testEntry{}
+	var err error
+	handler := httpu.StaleWarning(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		err = Fetch(r.Context(), scm.Get("test", time.Hour), "key", e, func(ctx context.Context) (CacheEntry, error) {
+			defer close(refreshed)
+			return &testEntry{data: []byte("fresh")}, nil
+		})
+		w.Write(e.data)
+	}))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if err != nil || string(e.data) != "stale" {
+		t.Fatalf("Expected stale value: %s, %v", e.data, err)
+	}
+
+	if rec.Header().Get("Warning") != httpu.StaleWarningHeader {
+		t.Errorf("Expected stale response to be marked")
+	}
+
+	select {
+	case <-refreshed:
+	case <-time.After(time.Second):
+		t.Fatalf("Expected entry to be refreshed in background")
+	}
+
+	// give the refresh a moment to save the loaded value
+	for i := 0; i < 100 && !loaded(scm.Get("test", time.Hour), "key", e); i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if string(e.data) != "fresh" {
+		t.Errorf("Expected refreshed value, got: %s", e.data)
+	}
+}
+
+func TestFetch_StaleIfError(t *testing.T) {
+	scm, cleanup := newTestCacheManager(t, CacheOptions{StaleIfError: time.Hour})
+	defer cleanup()
+
+	scm.Get("test", -time.Minute).Save("key", &testEntry{data: []byte("stale")})
+	scm.Get("test", -2*time.Hour).Save("old", &testEntry{data: []byte("stale")})
+
+	e := &testEntry{}
+	if err := Fetch(context.Background(), scm.Get("test", time.Hour), "key", e, failingLoader); err != nil || string(e.data) != "stale" {
+		t.Errorf("Expected stale value: %s, %v", e.data, err)
+	}
+
+	if err := Fetch(context.Background(), scm.Get("test", time.Hour), "old", &testEntry{}, failingLoader); err == nil {
+		t.Errorf("Expected error for entry that is too old")
+	}
+
+	e = &testEntry{}
+	if err := Fetch(context.Background(), scm.Get("test", time.Hour), "key", e, staticLoader("fresh")); err != nil || string(e.data) != "fresh" {
+		t.Errorf("Expected fresh value: %s, %v", e.data, err)
+	}
+}
+
+func TestFetch_CoalescesConcurrentLoads(t *testing.T) {
+	scm, cleanup := newTestCacheManager(t, CacheOptions{})
+	defer cleanup()
+
+	var calls int32
+	release := make(chan bool)
+	load := func(ctx context.Context) (CacheEntry, error) {
+		atomic.AddInt32(&calls, 1)
+		<-release
+		return &testEntry{data: []byte("loaded")}, nil
+	}
+
+	var wg sync.WaitGroup
+	results := make([]*testEntry, 5)
+	for i := range results {
+		results[i] = &testEntry{}
+		wg.Add(1)
+		go func(e *testEntry) {
+			defer wg.Done()
+			if err := Fetch(context.Background(), scm.Get("test", time.Hour), "key", e, load); err != nil {
+				t.Error(err)
+			}
+		}(results[i])
+	}
+
+	// let all the callers reach the loader before it completes
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if calls != 1 {
+		t.Errorf("Expected single load, got %d", calls)
+	}
+
+	for _, e := range results {
+		if string(e.data) != "loaded" {
+			t.Errorf("Unexpected value: %s", e.data)
+		}
+	}
+}
+
+func TestFetch_CancelledCallers(t *testing.T) {
+	scm, cleanup := newTestCacheManager(t, CacheOptions{})
+	defer cleanup()
+
+	started := make(chan bool)
+	release := make(chan bool)
+	load := func(ctx context.Context) (CacheEntry, error) {
+		started <- true
+		select {
+		case <-release:
+			return &testEntry{data: []byte("loaded")}, nil
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	// the caller that gives up doesn't cancel the load shared with another caller
+	ctx, cancel := context.WithCancel(context.Background())
+	errs := make(chan error)
+	go func() { errs <- Fetch(ctx, scm.Get("test", time.Hour), "key", &testEntry{}, load) }()
+	<-started
+
+	e := &testEntry{}
+	go func() { errs <- Fetch(context.Background(), scm.Get("test", time.Hour), "key", e, load) }()
+	time.Sleep(20 * time.Millisecond)
+
+	cancel()
+	if err := <-errs; err != context.Canceled {
+		t.Errorf("Expected cancelled caller to get context error, got %v", err)
+	}
+
+	close(release)
+	if err := <-errs; err != nil || string(e.data) != "loaded" {
+		t.Errorf("Expected loaded value: %s, %v", e.data, err)
+	}
+
+	// the load is cancelled once all the callers have given up
+	cancelled := make(chan bool)
+	blocked := func(ctx context.Context) (CacheEntry, error) {
+		started <- true
+		<-ctx.Done()
+		close(cancelled)
+		return nil, ctx.Err()
+	}
+
+	ctx, cancel = context.WithCancel(context.Background())
+	go func() { errs <- Fetch(ctx, scm.Get("test", time.Hour), "other", &testEntry{}, blocked) }()
+	<-started
+	cancel()
+
+	if err := <-errs; err != context.Canceled {
+		t.Errorf("Expected context error, got %v", err)
+	}
+
+	select {
+	case <-cancelled:
+	case <-time.After(time.Second):
+		t.Errorf("Expected load to be cancelled")
+	}
+}
+
+func TestMarkNotFound(t *testing.T) {
+	scm, cleanup := newTestCacheManager(t, CacheOptions{})
+	defer cleanup()
+
+	cache := scm.Get("not-found", time.Hour)
+	if IsMarkedNotFound(cache, "key") {
+		t.Fatalf("Expected key not to be marked")
+	}
+
+	if err := MarkNotFound(cache, "key"); err != nil {
+		t.Fatal(err)
+	}
+
+	if !IsMarkedNotFound(cache, "key") {
+		t.Errorf("Expected key to be marked")
+	}
+
+	if err := Forget(scm, "not-found", "key"); err != nil {
+		t.Fatal(err)
+	}
+
+	if IsMarkedNotFound(cache, "key") {
+		t.Errorf("Expected mark to be forgotten")
+	}
+
+	if err := Forget(scm, "missing", "key"); err != nil {
+		t.Errorf("Expected missing cache to be ignored, got %v", err)
+	}
+}
@@ -0,0 +1,77 @@
+package providers
+
+import (
+	"context"
+	"sync"
+)
+
+// flightCall is an in-flight or completed load of a single key
+type flightCall struct {
+	done    chan struct{}
+	data    []byte
+	err     error
+	waiters int
+	cancel  context.CancelFunc
+}
+
+// flightGroup deduplicates concurrent loads of the same key, so that
+// all the callers share the result of a single call to the remote service.
+type flightGroup struct {
+	mu    sync.Mutex
+	calls map[string]*flightCall
+}
+
+// Do executes fn unless there is a call in-flight for the same key.
+// In that case it waits for the running call and returns its result.
+//
+// The call isn't bound to the context of any single caller. It's cancelled
+// once all the callers waiting for it have given up.
+func (g *flightGroup) Do(ctx context.Context, key string, fn func(ctx context.Context) ([]byte, error)) ([]byte, error) {
+	g.mu.Lock()
+	if g.calls == nil {
+		g.calls = make(map[string]*flightCall)
+	}
+
+	c, ok := g.calls[key]
+	if !ok {
+		fctx, cancel := context.WithCancel(context.Background())
+		c = &flightCall{done: make(chan struct{}), cancel: cancel}
+		g.calls[key] = c
+
+		go func() {
+			c.data, c.err = fn(fctx)
+
+			g.mu.Lock()
+			g.forget(key, c)
+			g.mu.Unlock()
+
+			cancel()
+			close(c.done)
+		}()
+	}
+	c.waiters++
+	g.mu.Unlock()
+
+	select {
+	case <-c.done:
+		return c.data, c.err
+	case <-ctx.Done():
+		g.mu.Lock()
+		c.waiters--
+		if c.waiters == 0 {
+			// nobody needs the result anymore, so the next caller starts a new call
+			g.forget(key, c)
+			c.cancel()
+		}
+		g.mu.Unlock()
+
+		return nil, ctx.Err()
+	}
+}
+
+// forget removes the call unless it has been replaced already. Must be called with the lock held.
+func (g *flightGroup) forget(key string, c *flightCall) {
+	if g.calls[key] == c {
+		delete(g.calls, key)
+	}
+}
@@ -0,0 +1,195 @@
+package kinopub
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// DeviceURL is the endpoint of the device authorization flow
+const DeviceURL = "https://api.service-kp.com/oauth2/device"
+
+// slowDownStep is the number of seconds added to the polling interval every time
+// kinopub asks to slow down (RFC 8628, section 3.5)
+const slowDownStep = 5
+
+// second is the unit of the intervals issued with the device code. Tests shorten it.
+var second = time.Second
+
+var (
+	// ErrAuthorizationPending tells that the user hasn't entered the code yet
+	ErrAuthorizationPending = errors.New("authorization pending")
+	// ErrSlowDown tells that the token is requested too often
+	ErrSlowDown = errors.New("slow down")
+	// ErrDeviceCodeExpired tells that the user hasn't entered the code in time
+	ErrDeviceCodeExpired = errors.New("device code expired")
+)
+
+// DeviceCode is issued by kinopub to authorize the device. The user should
+// enter UserCode at VerificationURI.
+type DeviceCode struct {
+	Code            string `json:"code"`
+	UserCode        string `json:"user_code"`
+	VerificationURI string `json:"verification_uri"`
+	// Interval in seconds between the token requests
+	Interval int `json:"interval"`
+	// ExpiresIn is the lifetime of the code in seconds
+	ExpiresIn int `json:"expires_in"`
+}
+
+// DeviceAuthenticator runs the device authorization flow of kinopub
+type DeviceAuthenticator interface {
+	// RequestDeviceCode starts the flow
+	RequestDeviceCode(ctx context.Context) (*DeviceCode, error)
+
+	// PollDeviceToken requests the token once. Returns ErrAuthorizationPending until the user enters the code
+	// and ErrSlowDown when the token is requested too often.
+	PollDeviceToken(ctx context.Context, code string) (*Token, error)
+}
+
+// tokenResponse is returned by the kinopub oauth2 endpoints
+type tokenResponse struct {
+	AccessToken  string `json:"access_token,omitempty"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	ExpiresIn    int64  `json:"expires_in,omitempty"`
+	Error        string `json:"error,omitempty"`
+}
+
+// token converts the response to the token
+func (tr *tokenResponse) token() (*Token, error) {
+	if len(tr.RefreshToken) == 0 || len(tr.AccessToken) == 0 {
+		return nil, errors.New("empty access or refresh token")
+	}
+
+	return &Token{
+		AccessToken:  tr.AccessToken,
+		RefreshToken: tr.RefreshToken,
+		ExpiresAt:    time.Now().Add(time.Duration(tr.ExpiresIn) * time.Second),
+	}, nil
+}
+
+// saveToken stores received token in preferences
+func (cl KinoPubClientImpl) saveToken(tr *tokenResponse) (*Token, error) {
+	t, err := tr.token()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := cl.Tokens.Save(t); err != nil {
+		return nil, err
+	}
+
+	return t, nil
+}
+
+// RequestDeviceCode starts the device authorization flow
+func (cl KinoPubClientImpl) RequestDeviceCode(ctx context.Context) (*DeviceCode, error) {
+	resp, err := cl.do(ctx, "POST", DeviceURL, url.Values{
+		"grant_type":    {"device_code"},
+		"client_id":     {cl.ClientID},
+		"client_secret": {cl.ClientSecret},
+	}, nil)
+
+	if err != nil {
+		return nil, errors.WithMessage(err, "Network error")
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := ioutil.ReadAll(resp.Body)
+		return nil, errors.Errorf("Cannot request kinopub device code: service response - %s", msg)
+	}
+
+	dc := &DeviceCode{}
+	if err = json.NewDecoder(resp.Body).Decode(dc); err != nil {
+		return nil, err
+	}
+
+	if dc.Code == "" || dc.UserCode == "" {
+		return nil, errors.New("Cannot request kinopub device code: empty code")
+	}
+
+	return dc, nil
+}
+
+// PollDeviceToken requests the token for the device code and saves it once the user enters the code
+func (cl KinoPubClientImpl) PollDeviceToken(ctx context.Context, code string) (*Token, error) {
+	resp, err := cl.do(ctx, "POST", DeviceURL, url.Values{
+		"grant_type":    {"device_token"},
+		"client_id":     {cl.ClientID},
+		"client_secret": {cl.ClientSecret},
+		"code":          {code},
+	}, nil)
+
+	if err != nil {
+		return nil, errors.WithMessage(err, "Network error")
+	}
+
+	defer resp.Body.Close()
+
+	tr := &tokenResponse{}
+	if err = json.NewDecoder(resp.Body).Decode(tr); err != nil && resp.StatusCode == http.StatusOK {
+		return nil, err
+	}
+
+	switch tr.Error {
+	case "":
+	case "authorization_pending":
+		return nil, ErrAuthorizationPending
+	case "slow_down":
+		return nil, ErrSlowDown
+	case "expired_token", "code_expired":
+		return nil, ErrDeviceCodeExpired
+	default:
+		return nil, errors.Errorf("Cannot get kinopub token: service response - %s", tr.Error)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("Cannot get kinopub token: service response - %s", resp.Status)
+	}
+
+	return cl.saveToken(tr)
+}
+
+// WaitDeviceToken polls for the token at the interval requested by kinopub until the user
+// enters the code, the code expires or the context is done.
+func WaitDeviceToken(ctx context.Context, auth DeviceAuthenticator, dc *DeviceCode) (*Token, error) {
+	interval := time.Duration(dc.Interval) * second
+	if interval <= 0 {
+		interval = 5 * second
+	}
+
+	deadline := time.Now().Add(time.Duration(dc.ExpiresIn) * second)
+	for {
+		// the last wait is cut short, so the code is never polled after it expires
+		wait := interval
+		if left := time.Until(deadline); left < wait {
+			wait = left
+		}
+
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+
+		if !time.Now().Before(deadline) {
+			return nil, ErrDeviceCodeExpired
+		}
+
+		t, err := auth.PollDeviceToken(ctx, dc.Code)
+		switch err {
+		case ErrAuthorizationPending:
+		case ErrSlowDown:
+			interval += slowDownStep * second
+		default:
+			return t, err
+		}
+	}
+}
@@ -0,0 +1,144 @@
+package kinopub
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+)
+
+// deviceServer answers the token requests with the scripted errors and records when they were made
+type deviceServer struct {
+	errors []string
+
+	mu    sync.Mutex
+	polls []time.Time
+}
+
+func (s *deviceServer) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if req.URL.Path != "/oauth2/device" || req.URL.Query().Get("grant_type") != "device_token" {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	n := len(s.polls)
+	s.polls = append(s.polls, time.Now())
+
+	if n >= len(s.errors) {
+		fmt.Fprint(w, `{"access_token": "a2", "refresh_token": "r2", "expires_in": 3600}`)
+		return
+	}
+
+	w.WriteHeader(http.StatusBadRequest)
+	fmt.Fprintf(w, `{"error": %q}`, s.errors[n])
+}
+
+func (s *deviceServer) gaps(start time.Time) []time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r := make([]time.Duration, 0, len(s.polls))
+	for _, t := range s.polls {
+		r = append(r, t.Sub(start))
+		start = t
+	}
+	return r
+}
+
+func TestWaitDeviceToken(t *testing.T) {
+	defer func(s time.Duration) { second = s }(second)
+	second = 10 * time.Millisecond
+
+	pending := func(n int) []string {
+		r := make([]string, n)
+		for i := range r {
+			r[i] = "authorization_pending"
+		}
+		return r
+	}
+
+	tests := []struct {
+		name      string
+		errors    []string
+		dc        DeviceCode
+		wantErr   error
+		wantPolls int
+		// wantGaps are the minimal intervals before every poll
+		wantGaps []time.Duration
+	}{
+		{
+			name:      "Authorized",
+			errors:    pending(2),
+			dc:        DeviceCode{Code: "c1", Interval: 1, ExpiresIn: 100},
+			wantPolls: 3,
+			wantGaps:  []time.Duration{10 * time.Millisecond, 10 * time.Millisecond, 10 * time.Millisecond},
+		},
+		{
+			name:      "Slow down",
+			errors:    []string{"authorization_pending", "slow_down", "slow_down", "authorization_pending"},
+			dc:        DeviceCode{Code: "c1", Interval: 1, ExpiresIn: 100},
+			wantPolls: 5,
+			wantGaps:  []time.Duration{10 * time.Millisecond, 10 * time.Millisecond, 10 * time.Millisecond, 60 * time.Millisecond, 110 * time.Millisecond},
+		},
+		{
+			name:      "Code expires",
+			errors:    pending(100),
+			dc:        DeviceCode{Code: "c1", Interval: 4, ExpiresIn: 10},
+			wantErr:   ErrDeviceCodeExpired,
+			wantPolls: 2,
+			wantGaps:  []time.Duration{40 * time.Millisecond, 40 * time.Millisecond},
+		},
+		{
+			name:      "Code is rejected",
+			errors:    []string{"authorization_pending", "code_expired"},
+			dc:        DeviceCode{Code: "c1", Interval: 1, ExpiresIn: 100},
+			wantErr:   ErrDeviceCodeExpired,
+			wantPolls: 2,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := &deviceServer{errors: tt.errors}
+			cl, cleanup := newTestClient(t, srv)
+			defer cleanup()
+
+			start := time.Now()
+			token, err := WaitDeviceToken(context.Background(), cl, &tt.dc)
+			if err != tt.wantErr {
+				t.Fatalf("WaitDeviceToken() error = %v, want %v", err, tt.wantErr)
+			}
+
+			if err == nil && token.AccessToken != "a2" {
+				t.Errorf("WaitDeviceToken() = %+v, want issued token", token)
+			}
+
+			gaps := srv.gaps(start)
+			if len(gaps) != tt.wantPolls {
+				t.Fatalf("Token is polled %d times, want %d", len(gaps), tt.wantPolls)
+			}
+
+			for i, want := range tt.wantGaps {
+				if gaps[i] < want {
+					t.Errorf("Poll %d is made after %v, want at least %v", i+1, gaps[i], want)
+				}
+			}
+
+			if expires := time.Duration(tt.dc.ExpiresIn) * second; sum(gaps) >= expires {
+				t.Errorf("Token is polled after %v, the code expires in %v", sum(gaps), expires)
+			}
+		})
+	}
+}
+
+func sum(ds []time.Duration) time.Duration {
+	var r time.Duration
+	for _, d := range ds {
+		r += d
+	}
+	return r
+}
@@ -0,0 +1,139 @@
+package kinopub
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/dpfg/kinohub-core/domain"
+	httpu "github.com/dpfg/kinohub-core/pkg/http"
+	"github.com/pkg/errors"
+)
+
+// BookmarkFolder groups bookmarked items of the kinopub account
+type BookmarkFolder struct {
+	ID    int    `json:"id"`
+	Title string `json:"title"`
+	Views int    `json:"views"`
+	Count int    `json:"count"`
+	// Created and Updated are unix timestamps
+	Created int64 `json:"created"`
+	Updated int64 `json:"updated"`
+}
+
+// ToDomain converts kinopub folder
+func (f BookmarkFolder) ToDomain() domain.BookmarkFolder {
+	return domain.BookmarkFolder{
+		ID:        f.ID,
+		Title:     f.Title,
+		Count:     f.Count,
+		UpdatedAt: time.Unix(f.Updated, 0),
+	}
+}
+
+// GetBookmarkFolders returns all bookmark folders of the account
+func (cl KinoPubClientImpl) GetBookmarkFolders(ctx context.Context) ([]BookmarkFolder, error) {
+	m := &struct {
+		Items []BookmarkFolder `json:"items"`
+	}{}
+
+	if err := cl.callBookmarks(ctx, "GET", "", nil, m); err != nil {
+		return nil, err
+	}
+
+	return m.Items, nil
+}
+
+// GetBookmarkItems returns a page (1-based) of the items in the folder
+func (cl KinoPubClientImpl) GetBookmarkItems(ctx context.Context, folderID int, page int) (*ItemsPage, error) {
+	params := url.Values{}
+	if page > 0 {
+		params.Set("page", strconv.Itoa(page))
+	}
+
+	m := &ItemsPage{}
+	if err := cl.callBookmarks(ctx, "GET", strconv.Itoa(folderID), params, m); err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
+
+// CreateBookmarkFolder creates a new folder with provided title
+func (cl KinoPubClientImpl) CreateBookmarkFolder(ctx context.Context, title string) (*BookmarkFolder, error) {
+	m := &struct {
+		Folder BookmarkFolder `json:"folder"`
+	}{}
+
+	if err := cl.callBookmarks(ctx, "POST", "create", url.Values{"title": {title}}, m); err != nil {
+		return nil, err
+	}
+
+	return &m.Folder, nil
+}
+
+// RemoveBookmarkFolder deletes the folder with all its bookmarks
+func (cl KinoPubClientImpl) RemoveBookmarkFolder(ctx context.Context, folderID int) error {
+	return cl.callBookmarks(ctx, "POST", "remove-folder", url.Values{"folder": {strconv.Itoa(folderID)}}, nil)
+}
+
+// AddBookmark adds the item to the folder
+func (cl KinoPubClientImpl) AddBookmark(ctx context.Context, folderID int, itemID int) error {
+	return cl.callBookmarks(ctx, "POST", "add", url.Values{
+		"folder": {strconv.Itoa(folderID)},
+		"item":   {strconv.Itoa(itemID)},
+	}, nil)
+}
+
+// RemoveBookmark removes the item from the folder
+func (cl KinoPubClientImpl) RemoveBookmark(ctx context.Context, folderID int, itemID int) error {
+	return cl.callBookmarks(ctx, "POST", "remove-item", url.Values{
+		"folder": {strconv.Itoa(folderID)},
+		"item":   {strconv.Itoa(itemID)},
+	}, nil)
+}
+
+// callBookmarks calls kinopub /bookmarks API. Parameters of POST requests are sent as a form.
+// The response is decoded into out unless it's nil.
+func (cl KinoPubClientImpl) callBookmarks(ctx context.Context, method string, action string, params url.Values, out interface{}) error {
+	t, err := cl.getToken(ctx)
+	if err != nil {
+		return errors.Wrap(err, "No auth")
+	}
+
+	uri := httpu.JoinURL(BaseURL, "bookmarks")
+	if action != "" {
+		uri = httpu.JoinURL(uri, action)
+	}
+
+	query := url.Values{"access_token": {t.AccessToken}}
+	var form url.Values
+
+	if method == "GET" {
+		for k, v := range params {
+			query[k] = v
+		}
+	} else {
+		form = params
+	}
+
+	resp, err := cl.do(ctx, method, uri, query, form)
+	if err != nil {
+		return errors.WithMessage(err, "Network error")
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return errors.Errorf("Unexpected status code: %s", resp.Status)
+	}
+
+	if out == nil {
+		return nil
+	}
+
+	return errors.WithStack(json.NewDecoder(resp.Body).Decode(out))
+}
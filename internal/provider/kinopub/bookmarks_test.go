@@ -0,0 +1,139 @@
+package kinopub
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"reflect"
+	"testing"
+)
+
+func TestBookmarks(t *testing.T) {
+	tests := []struct {
+		name       string
+		call       func(cl KinoPubClientImpl) (interface{}, error)
+		response   string
+		status     int
+		wantMethod string
+		wantPath   string
+		wantParams url.Values
+		want       interface{}
+		wantErr    bool
+	}{
+		{
+			name: "Folders",
+			call: func(cl KinoPubClientImpl) (interface{}, error) {
+				return cl.GetBookmarkFolders(context.Background())
+			},
+			response:   `{"status": 200, "items": [{"id": 1, "title": "Family", "views": 3, "count": 2, "created": 1546300800, "updated": 1546387200}]}`,
+			wantMethod: "GET",
+			wantPath:   "/v1/bookmarks",
+			wantParams: url.Values{},
+			want:       []BookmarkFolder{{ID: 1, Title: "Family", Views: 3, Count: 2, Created: 1546300800, Updated: 1546387200}},
+		},
+		{
+			name: "Folder items",
+			call: func(cl KinoPubClientImpl) (interface{}, error) {
+				page, err := cl.GetBookmarkItems(context.Background(), 1, 2)
+				if err != nil {
+					return nil, err
+				}
+				return page.Items[0].ID, nil
+			},
+			response:   `{"status": 200, "items": [{"id": 8930, "type": "serial", "title": "Теория большого взрыва / The Big Bang Theory", "bookmarks": [1]}], "pagination": {"total": 2, "current": 2, "perpage": 20}}`,
+			wantMethod: "GET",
+			wantPath:   "/v1/bookmarks/1",
+			wantParams: url.Values{"page": {"2"}},
+			want:       8930,
+		},
+		{
+			name: "Create folder",
+			call: func(cl KinoPubClientImpl) (interface{}, error) {
+				return cl.CreateBookmarkFolder(context.Background(), "Kids")
+			},
+			response:   `{"status": 200, "folder": {"id": 2, "title": "Kids"}}`,
+			wantMethod: "POST",
+			wantPath:   "/v1/bookmarks/create",
+			wantParams: url.Values{"title": {"Kids"}},
+			want:       &BookmarkFolder{ID: 2, Title: "Kids"},
+		},
+		{
+			name: "Remove folder",
+			call: func(cl KinoPubClientImpl) (interface{}, error) {
+				return nil, cl.RemoveBookmarkFolder(context.Background(), 2)
+			},
+			response:   `{"status": 200}`,
+			wantMethod: "POST",
+			wantPath:   "/v1/bookmarks/remove-folder",
+			wantParams: url.Values{"folder": {"2"}},
+		},
+		{
+			name: "Add item",
+			call: func(cl KinoPubClientImpl) (interface{}, error) {
+				return nil, cl.AddBookmark(context.Background(), 1, 8930)
+			},
+			response:   `{"status": 200}`,
+			wantMethod: "POST",
+			wantPath:   "/v1/bookmarks/add",
+			wantParams: url.Values{"folder": {"1"}, "item": {"8930"}},
+		},
+		{
+			name: "Remove item",
+			call: func(cl KinoPubClientImpl) (interface{}, error) {
+				return nil, cl.RemoveBookmark(context.Background(), 1, 8930)
+			},
+			response:   `{"status": 200}`,
+			wantMethod: "POST",
+			wantPath:   "/v1/bookmarks/remove-item",
+			wantParams: url.Values{"folder": {"1"}, "item": {"8930"}},
+		},
+		{
+			name: "Service error",
+			call: func(cl KinoPubClientImpl) (interface{}, error) {
+				return nil, cl.AddBookmark(context.Background(), 1, 8930)
+			},
+			status:     http.StatusNotFound,
+			wantMethod: "POST",
+			wantPath:   "/v1/bookmarks/add",
+			wantParams: url.Values{"folder": {"1"}, "item": {"8930"}},
+			wantErr:    true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gotMethod, gotPath, gotToken string
+			var gotParams url.Values
+
+			cl, cleanup := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				r.ParseForm()
+				gotMethod, gotPath, gotToken = r.Method, r.URL.Path, r.URL.Query().Get("access_token")
+
+				gotParams = r.Form
+				gotParams.Del("access_token")
+
+				if tt.status != 0 {
+					w.WriteHeader(tt.status)
+				}
+				w.Write([]byte(tt.response))
+			}))
+			defer cleanup()
+
+			got, err := tt.call(cl)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if gotMethod != tt.wantMethod || gotPath != tt.wantPath || !reflect.DeepEqual(gotParams, tt.wantParams) {
+				t.Errorf("Request = %s %s %v, want %s %s %v", gotMethod, gotPath, gotParams, tt.wantMethod, tt.wantPath, tt.wantParams)
+			}
+
+			if gotToken != "test-token" {
+				t.Errorf("Request is not authorized: %q", gotToken)
+			}
+
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
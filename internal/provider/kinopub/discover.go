@@ -0,0 +1,151 @@
+package kinopub
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/dpfg/kinohub-core/domain"
+	provider "github.com/dpfg/kinohub-core/internal/provider"
+	httpu "github.com/dpfg/kinohub-core/pkg/http"
+	"github.com/pkg/errors"
+)
+
+// Discovery feeds of kinopub
+const (
+	FeedFresh   = "fresh"
+	FeedHot     = "hot"
+	FeedPopular = "popular"
+)
+
+const (
+	// DiscoverCache holds pages of the discovery feeds
+	DiscoverCache = "KP_Discover"
+	// CollectionsCache holds editorial collections
+	CollectionsCache = "KP_Collections"
+)
+
+// Collection is an editorial selection of kinopub items
+type Collection struct {
+	ID       int    `json:"id"`
+	Title    string `json:"title"`
+	Watchers int    `json:"watchers"`
+	Views    int    `json:"views"`
+	Posters  struct {
+		Small  string `json:"small"`
+		Medium string `json:"medium"`
+		Big    string `json:"big"`
+	} `json:"posters"`
+}
+
+// ToDomain converts kinopub collection
+func (c Collection) ToDomain() domain.Collection {
+	return domain.Collection{
+		ID:         c.ID,
+		Title:      c.Title,
+		PosterPath: c.Posters.Big,
+	}
+}
+
+// CollectionsPage is a single page of the collections list
+type CollectionsPage struct {
+	Items      []Collection `json:"items"`
+	Pagination Pagination   `json:"pagination"`
+}
+
+// CollectionView is a collection with all its items
+type CollectionView struct {
+	Collection Collection `json:"collection"`
+	Items      []Item     `json:"items"`
+}
+
+// DiscoverItems returns a page of the discovery feed. Only type and pagination of the filter are used.
+func (cl KinoPubClientImpl) DiscoverItems(ctx context.Context, feed string, q ItemsFilter) (*ItemsPage, error) {
+	switch feed {
+	case FeedFresh, FeedHot, FeedPopular:
+	default:
+		return nil, errors.Errorf("Unknown discovery feed [%s]", feed)
+	}
+
+	if err := q.Validate(); err != nil {
+		return nil, err
+	}
+
+	params := ItemsFilter{Type: q.Type, Page: q.Page, PerPage: q.PerPage}.Values()
+
+	page := &ItemsPage{}
+	err := cl.getCached(ctx, cl.CacheFactory.Get(DiscoverCache, 30*time.Minute), httpu.JoinURL(BaseURL, "items", feed), params, page)
+	if err != nil {
+		return nil, err
+	}
+
+	return page, nil
+}
+
+// GetCollections returns a page (1-based) of the editorial collections
+func (cl KinoPubClientImpl) GetCollections(ctx context.Context, page int) (*CollectionsPage, error) {
+	params := url.Values{}
+	if page > 0 {
+		params.Set("page", strconv.Itoa(page))
+	}
+
+	m := &CollectionsPage{}
+	err := cl.getCached(ctx, cl.CacheFactory.Get(CollectionsCache, 6*time.Hour), httpu.JoinURL(BaseURL, "collections"), params, m)
+	if err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
+
+// GetCollection returns collection with its items
+func (cl KinoPubClientImpl) GetCollection(ctx context.Context, id int) (*CollectionView, error) {
+	params := url.Values{"id": {strconv.Itoa(id)}}
+
+	m := &CollectionView{}
+	err := cl.getCached(ctx, cl.CacheFactory.Get(CollectionsCache, 6*time.Hour), httpu.JoinURL(BaseURL, "collections", "view"), params, m)
+	if err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
+
+// getCached loads JSON response into out through the cache
+func (cl KinoPubClientImpl) getCached(ctx context.Context, cache provider.Cache, uri string, params url.Values, out interface{}) error {
+	key := uri + "?" + params.Encode()
+
+	return provider.Fetch(ctx, cache, key, provider.Cacheable(out), func(ctx context.Context) (provider.CacheEntry, error) {
+		t, err := cl.getToken(ctx)
+		if err != nil {
+			return nil, errors.Wrap(err, "No auth")
+		}
+
+		query := url.Values{"access_token": {t.AccessToken}}
+		for k, v := range params {
+			query[k] = v
+		}
+
+		resp, err := cl.do(ctx, "GET", uri, query, nil)
+		if err != nil {
+			return nil, errors.WithMessage(err, "Network error")
+		}
+
+		defer resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			return nil, errors.Errorf("Unexpected status code: %s", resp.Status)
+		}
+
+		body, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			return nil, errors.WithMessage(err, "cannot read response body")
+		}
+
+		data := provider.RawEntry(body)
+		return &data, nil
+	})
+}
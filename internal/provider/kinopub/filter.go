@@ -0,0 +1,133 @@
+package kinopub
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Types of kinopub items
+const (
+	ItemTypeMovie     = "movie"
+	ItemTypeSerial    = "serial"
+	ItemTypeDocuMovie = "documovie"
+	ItemTypeConcert   = "concert"
+)
+
+// sortFields lists fields kinopub can sort items by
+var sortFields = map[string]bool{
+	"id":               true,
+	"year":             true,
+	"title":            true,
+	"created":          true,
+	"updated":          true,
+	"rating":           true,
+	"views":            true,
+	"watchers":         true,
+	"imdb_rating":      true,
+	"kinopoisk_rating": true,
+}
+
+// ItemsFilter defines query of the kinopub catalogue. Zero values are not sent.
+type ItemsFilter struct {
+	Title string
+	// Type is one of movie, serial, documovie or concert
+	Type      string
+	Genres    []int
+	Countries []int
+	YearFrom  int
+	YearTo    int
+	// Quality lists ids of the video qualities
+	Quality []int
+	// Sort is a field to sort by. Prefix it with minus to sort in descending order.
+	Sort    string
+	Page    int
+	PerPage int
+}
+
+// Validate checks that the filter is accepted by kinopub
+func (f ItemsFilter) Validate() error {
+	switch f.Type {
+	case "", ItemTypeMovie, ItemTypeSerial, ItemTypeDocuMovie, ItemTypeConcert:
+	default:
+		return errors.Errorf("Unknown item type [%s]", f.Type)
+	}
+
+	if f.Sort != "" && !sortFields[strings.TrimPrefix(f.Sort, "-")] {
+		return errors.Errorf("Unknown sort order [%s]", f.Sort)
+	}
+
+	if f.YearFrom > 0 && f.YearTo > 0 && f.YearFrom > f.YearTo {
+		return errors.Errorf("Invalid year range [%d-%d]", f.YearFrom, f.YearTo)
+	}
+
+	if f.Page < 0 || f.PerPage < 0 {
+		return errors.New("Page and page size must not be negative")
+	}
+
+	return nil
+}
+
+// Values returns query parameters of the kinopub /items endpoint
+func (f ItemsFilter) Values() url.Values {
+	v := url.Values{}
+
+	set := func(name string, value string) {
+		if value != "" {
+			v.Set(name, value)
+		}
+	}
+
+	set("title", f.Title)
+	set("type", f.Type)
+	set("genre", joinInts(f.Genres))
+	set("country", joinInts(f.Countries))
+	set("quality", joinInts(f.Quality))
+	set("sort", f.Sort)
+
+	switch {
+	case f.YearFrom > 0 && f.YearTo > 0:
+		set("year", fmt.Sprintf("%d-%d", f.YearFrom, f.YearTo))
+	case f.YearFrom > 0:
+		set("year", fmt.Sprintf("%d-", f.YearFrom))
+	case f.YearTo > 0:
+		set("year", fmt.Sprintf("-%d", f.YearTo))
+	}
+
+	if f.Page > 0 {
+		set("page", strconv.Itoa(f.Page))
+	}
+
+	if f.PerPage > 0 {
+		set("perpage", strconv.Itoa(f.PerPage))
+	}
+
+	return v
+}
+
+func joinInts(values []int) string {
+	s := make([]string, 0, len(values))
+	for _, i := range values {
+		s = append(s, strconv.Itoa(i))
+	}
+
+	return strings.Join(s, ",")
+}
+
+// Pagination describes the page of the kinopub response
+type Pagination struct {
+	// Total is the number of pages
+	Total      int `json:"total"`
+	Current    int `json:"current"`
+	PerPage    int `json:"perpage"`
+	TotalItems int `json:"total_items"`
+}
+
+// ItemsPage is a single page of the kinopub catalogue
+type ItemsPage struct {
+	Items      []Item     `json:"items"`
+	Pagination Pagination `json:"pagination"`
+}
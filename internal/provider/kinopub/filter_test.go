@@ -0,0 +1,52 @@
+package kinopub
+
+import (
+	"testing"
+)
+
+func TestItemsFilter_Values(t *testing.T) {
+	tests := []struct {
+		name   string
+		filter ItemsFilter
+		want   string
+	}{
+		{name: "Empty", filter: ItemsFilter{}, want: ""},
+		{name: "Title", filter: ItemsFilter{Title: "south park"}, want: "title=south+park"},
+		{
+			name:   "All",
+			filter: ItemsFilter{Type: ItemTypeSerial, Genres: []int{1, 2}, Countries: []int{3}, Quality: []int{4}, YearFrom: 2000, YearTo: 2010, Sort: "-rating", Page: 2, PerPage: 50},
+			want:   "country=3&genre=1%2C2&page=2&perpage=50&quality=4&sort=-rating&type=serial&year=2000-2010",
+		},
+		{name: "Year from", filter: ItemsFilter{YearFrom: 2000}, want: "year=2000-"},
+		{name: "Year to", filter: ItemsFilter{YearTo: 2010}, want: "year=-2010"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.filter.Values().Encode(); got != tt.want {
+				t.Errorf("ItemsFilter.Values() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestItemsFilter_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		filter  ItemsFilter
+		wantErr bool
+	}{
+		{name: "Empty", filter: ItemsFilter{}, wantErr: false},
+		{name: "Valid", filter: ItemsFilter{Type: ItemTypeConcert, Sort: "-year", YearFrom: 2000, YearTo: 2000}, wantErr: false},
+		{name: "Unknown type", filter: ItemsFilter{Type: "cartoon"}, wantErr: true},
+		{name: "Unknown sort", filter: ItemsFilter{Sort: "-size"}, wantErr: true},
+		{name: "Inverted years", filter: ItemsFilter{YearFrom: 2010, YearTo: 2000}, wantErr: true},
+		{name: "Negative page", filter: ItemsFilter{Page: -1}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.filter.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("ItemsFilter.Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
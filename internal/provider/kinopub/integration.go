@@ -0,0 +1,137 @@
+package kinopub
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	httpu "github.com/dpfg/kinohub-core/pkg/http"
+	"github.com/go-chi/chi"
+	"github.com/go-chi/render"
+	"github.com/sirupsen/logrus"
+)
+
+// States of the device authorization
+const (
+	DeviceAuthIdle       = "idle"
+	DeviceAuthPending    = "pending"
+	DeviceAuthAuthorized = "authorized"
+	DeviceAuthExpired    = "expired"
+	DeviceAuthFailed     = "failed"
+)
+
+// DeviceAuthStatus describes the latest device authorization
+type DeviceAuthStatus struct {
+	State           string    `json:"state"`
+	UserCode        string    `json:"user_code,omitempty"`
+	VerificationURI string    `json:"verification_uri,omitempty"`
+	ExpiresAt       time.Time `json:"expires_at,omitempty"`
+	Error           string    `json:"error,omitempty"`
+}
+
+// Integration with kinopub account
+type Integration struct {
+	Auth   DeviceAuthenticator
+	Tokens *TokenManager
+	Logger *logrus.Entry
+
+	mu     sync.Mutex
+	status DeviceAuthStatus
+}
+
+// Handler with defined routes for kinopub integration
+func (kp *Integration) Handler() http.Handler {
+	router := chi.NewRouter()
+
+	router.Post("/device", func(w http.ResponseWriter, req *http.Request) {
+		if !kp.start() {
+			render.Status(req, http.StatusConflict)
+			render.JSON(w, req, kp.Status())
+			return
+		}
+
+		dc, err := kp.Auth.RequestDeviceCode(req.Context())
+		if err != nil {
+			kp.setStatus(DeviceAuthStatus{State: DeviceAuthFailed, Error: err.Error()})
+			httpu.BadGateway(w, req, err)
+			return
+		}
+
+		kp.setStatus(DeviceAuthStatus{
+			State:           DeviceAuthPending,
+			UserCode:        dc.UserCode,
+			VerificationURI: dc.VerificationURI,
+			ExpiresAt:       time.Now().Add(time.Duration(dc.ExpiresIn) * time.Second),
+		})
+
+		go kp.wait(dc)
+
+		render.Status(req, http.StatusAccepted)
+		render.JSON(w, req, kp.Status())
+	})
+
+	router.Get("/device", func(w http.ResponseWriter, req *http.Request) {
+		render.JSON(w, req, kp.Status())
+	})
+
+	router.Get("/token", func(w http.ResponseWriter, req *http.Request) {
+		render.JSON(w, req, kp.Tokens.Status())
+	})
+
+	return router
+}
+
+// Status returns a snapshot of the latest device authorization
+func (kp *Integration) Status() DeviceAuthStatus {
+	kp.mu.Lock()
+	defer kp.mu.Unlock()
+
+	if kp.status.State == "" {
+		return DeviceAuthStatus{State: DeviceAuthIdle}
+	}
+
+	return kp.status
+}
+
+// start marks the authorization as pending unless another one is in progress
+func (kp *Integration) start() bool {
+	kp.mu.Lock()
+	defer kp.mu.Unlock()
+
+	if kp.status.State == DeviceAuthPending {
+		return false
+	}
+
+	kp.status = DeviceAuthStatus{State: DeviceAuthPending}
+	return true
+}
+
+func (kp *Integration) setStatus(status DeviceAuthStatus) {
+	kp.mu.Lock()
+	defer kp.mu.Unlock()
+
+	kp.status = status
+}
+
+// wait polls for the token in background and records the outcome
+func (kp *Integration) wait(dc *DeviceCode) {
+	// polling outlives the request that has started it
+	_, err := WaitDeviceToken(context.Background(), kp.Auth, dc)
+
+	kp.mu.Lock()
+	defer kp.mu.Unlock()
+
+	switch err {
+	case nil:
+		kp.Logger.Infoln("Kinopub device has been authorized")
+		kp.status.State = DeviceAuthAuthorized
+	case ErrDeviceCodeExpired:
+		kp.Logger.Warnln("Kinopub device code has expired")
+		kp.status.State = DeviceAuthExpired
+	default:
+		kp.Logger.Errorf("Kinopub device authorization has failed: %s", err.Error())
+		kp.status.State = DeviceAuthFailed
+		kp.status.Error = err.Error()
+	}
+}
@@ -1,8 +1,12 @@
 package kinopub
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
+	"io/ioutil"
 	"net/http"
+	"net/url"
 	"os"
 	"strconv"
 	"time"
@@ -11,7 +15,6 @@ import (
 
 	provider "github.com/dpfg/kinohub-core/internal/provider"
 	httpu "github.com/dpfg/kinohub-core/pkg/http"
-	"github.com/franela/goreq"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 )
@@ -22,6 +25,7 @@ type Token struct {
 	ExpiresAt    time.Time `json:"expires_at,omitempty"`
 }
 
+// IsValid tells whether the token can be used now
 func (t *Token) IsValid() bool {
 	if t.AccessToken == "" || t.RefreshToken == "" || t.ExpiresAt.Before(time.Now()) {
 		return false
@@ -31,17 +35,47 @@ func (t *Token) IsValid() bool {
 }
 
 type KinoPubClient interface {
-	SearchItemBy(q ItemsFilter) ([]Item, error)
+	SearchItemBy(ctx context.Context, q ItemsFilter) (*ItemsPage, error)
 
-	GetItemById(id int) (*Item, error)
+	GetItemById(ctx context.Context, id int) (*Item, error)
 
-	GetEpisode(imdbID int, title string, seasonNum int, episodeNum int) (interface{}, error)
+	GetEpisode(ctx context.Context, q MatchQuery, seasonNum int, episodeNum int) (*Episode, error)
 
-	FindItemByIMDB(imdbID int, title string) (*Item, error)
-}
+	// MatchItem returns item linked to the TMDB show or movie, falling back to the search by titles.
+	// Nil is returned if nothing matches.
+	MatchItem(ctx context.Context, q MatchQuery) (*Match, error)
+
+	// ForgetMatch drops cached result of the lookup, found or not.
+	ForgetMatch(q MatchQuery) error
+
+	// MarkEpisodeWatched marks episode of the serial as watched or unwatched
+	MarkEpisodeWatched(ctx context.Context, itemID int, seasonNum int, episodeNum int, watched bool) error
+
+	// MarkSeasonWatched marks all the episodes of the season as watched or unwatched
+	MarkSeasonWatched(ctx context.Context, itemID int, seasonNum int, watched bool) error
+
+	// SaveEpisodePosition stores position in seconds to resume the episode from
+	SaveEpisodePosition(ctx context.Context, itemID int, seasonNum int, episodeNum int, position int) error
+
+	GetBookmarkFolders(ctx context.Context) ([]BookmarkFolder, error)
+
+	// GetBookmarkItems returns a page (1-based) of the items in the folder
+	GetBookmarkItems(ctx context.Context, folderID int, page int) (*ItemsPage, error)
+
+	CreateBookmarkFolder(ctx context.Context, title string) (*BookmarkFolder, error)
+
+	RemoveBookmarkFolder(ctx context.Context, folderID int) error
+
+	AddBookmark(ctx context.Context, folderID int, itemID int) error
+
+	RemoveBookmark(ctx context.Context, folderID int, itemID int) error
+
+	// DiscoverItems returns a page of the fresh, hot or popular items
+	DiscoverItems(ctx context.Context, feed string, q ItemsFilter) (*ItemsPage, error)
 
-type ItemsFilter struct {
-	Title string `url:"title,omitempty"`
+	GetCollections(ctx context.Context, page int) (*CollectionsPage, error)
+
+	GetCollection(ctx context.Context, id int) (*CollectionView, error)
 }
 
 type KinoPubClientImpl struct {
@@ -49,8 +83,12 @@ type KinoPubClientImpl struct {
 	ClientSecret      string
 	PreferenceStorage provider.PreferenceStorage
 	CacheFactory      provider.CacheFactory
-	Logger            *logrus.Entry
-	fixer             *fixer
+	Links             *LinkStore
+	// Tokens keeps the token shared by the copies of the client. Required.
+	Tokens *TokenManager
+	// HTTP is used instead of the shared client built from HTTPOptions
+	HTTP   *http.Client
+	Logger *logrus.Entry
 }
 
 const (
@@ -58,247 +96,289 @@ const (
 	TokenURL = "https://api.service-kp.com/oauth2/token"
 
 	KinoPubPrefKey = "kinopub"
+
+	// ItemsCache holds items by id
+	ItemsCache = "KP_GetItemById"
+
+	// MatchCache holds items matched to TMDB shows and movies
+	MatchCache = "KP_MatchItem"
+	// MatchNotFoundCache holds TMDB shows and movies that have no matching item
+	MatchNotFoundCache = "KP_MatchItem_NotFound"
 )
 
-type authQuery struct {
-	AccessToken string `url:"access_token"`
+// HTTPOptions configures resilience of the requests to the kinopub API
+var HTTPOptions = httpu.TransportOptions{
+	Name:             "kinopub",
+	Timeout:          20 * time.Second,
+	MaxRetries:       2,
+	MinBackoff:       500 * time.Millisecond,
+	MaxBackoff:       5 * time.Second,
+	MaxRetryAfter:    10 * time.Second,
+	BreakerThreshold: 5,
+	BreakerCooldown:  30 * time.Second,
 }
 
-func (cl KinoPubClientImpl) getToken() (*Token, error) {
-	t := &Token{}
-	err := cl.PreferenceStorage.Load(KinoPubPrefKey, t)
+var defaultHTTPClient = httpu.NewClient(HTTPOptions)
+
+// do sends request to the kinopub API. Form values, if any, are sent in the body.
+func (cl KinoPubClientImpl) do(ctx context.Context, method string, uri string, query url.Values, form url.Values) (*http.Response, error) {
+	req, err := httpu.NewRequest(ctx, method, uri, query, form)
 	if err != nil {
-		return nil, errors.Wrap(err, "Unable to load preferences")
+		return nil, err
 	}
 
-	if !t.IsValid() {
-		if err = cl.refreshToken(t); err != nil {
-			return nil, errors.Wrap(err, "Unable to refresh access token")
-		}
-
-		if err = cl.PreferenceStorage.Load(KinoPubPrefKey, t); err != nil {
-			return nil, errors.Wrap(err, "Unable to load preferences")
-		}
+	if cl.HTTP != nil {
+		return cl.HTTP.Do(req)
 	}
 
-	return t, nil
+	return defaultHTTPClient.Do(req)
 }
 
-func (cl KinoPubClientImpl) refreshToken(t *Token) error {
-	cl.Logger.Debugln("refreshing token....")
-	resp, err := goreq.Request{
-		Method: "POST",
-		Uri:    TokenURL,
-		QueryString: struct {
-			GrantType    string `url:"grant_type,omitempty"`
-			ClientID     string `url:"client_id,omitempty"`
-			ClientSecret string `url:"client_secret,omitempty"`
-			RefreshToken string `url:"refresh_token,omitempty"`
-		}{
-			GrantType:    "refresh_token",
-			ClientID:     cl.ClientID,
-			ClientSecret: cl.ClientSecret,
-			RefreshToken: t.RefreshToken,
-		},
-	}.Do()
+type authQuery struct {
+	AccessToken string `url:"access_token"`
+}
+
+func (cl KinoPubClientImpl) getToken(ctx context.Context) (*Token, error) {
+	return cl.Tokens.Token(ctx, cl.refreshToken)
+}
+
+// refreshToken exchanges the refresh token for the new token
+func (cl KinoPubClientImpl) refreshToken(ctx context.Context, refreshToken string) (*Token, error) {
+	resp, err := cl.do(ctx, "POST", TokenURL, url.Values{
+		"grant_type":    {"refresh_token"},
+		"client_id":     {cl.ClientID},
+		"client_secret": {cl.ClientSecret},
+		"refresh_token": {refreshToken},
+	}, nil)
 
 	if err != nil {
-		return err
+		return nil, err
 	}
 
+	defer resp.Body.Close()
+
 	if resp.StatusCode != http.StatusOK {
-		msg, _ := resp.Body.ToString()
-		return errors.Errorf("Cannot refresh kinopub token: service response - %s", msg)
+		msg, _ := ioutil.ReadAll(resp.Body)
+		return nil, errors.Errorf("Cannot refresh kinopub token: service response - %s", msg)
 	}
 
-	nt := &struct {
-		AccessToken  string `json:"access_token,omitempty"`
-		RefreshToken string `json:"refresh_token,omitempty"`
-		ExpiresIn    int64  `json:"expires_in,omitempty"`
-	}{}
-	err = resp.Body.FromJsonTo(nt)
+	nt := &tokenResponse{}
+	err = json.NewDecoder(resp.Body).Decode(nt)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	if len(nt.RefreshToken) == 0 || len(nt.AccessToken) == 0 {
-		return errors.Errorf("Cannot refresh kinohub token: empty refresh token.")
+	t, err := nt.token()
+	if err != nil {
+		return nil, errors.WithMessage(err, "Cannot refresh kinohub token")
 	}
 
-	cl.PreferenceStorage.Save(KinoPubPrefKey, &Token{
-		AccessToken:  nt.AccessToken,
-		RefreshToken: nt.RefreshToken,
-		ExpiresAt:    time.Now().Add(time.Duration(nt.ExpiresIn) * time.Second),
-	})
-	return nil
+	return t, nil
 }
 
-func (cl KinoPubClientImpl) SearchItemBy(q ItemsFilter) ([]Item, error) {
-	t, err := cl.getToken()
+// SearchItemBy returns single page of the items that match the filter
+func (cl KinoPubClientImpl) SearchItemBy(ctx context.Context, q ItemsFilter) (*ItemsPage, error) {
+	if err := q.Validate(); err != nil {
+		return nil, err
+	}
+
+	t, err := cl.getToken(ctx)
 	if err != nil {
 		return nil, errors.Wrap(err, "No auth")
 	}
 
-	resp, err := goreq.Request{
-		Method: "GET",
-		Uri:    httpu.JoinURL(BaseURL, "items"),
-		QueryString: struct {
-			Title       string `url:"title,omitempty"`
-			AccessToken string `url:"access_token,omitempty"`
-		}{
-			Title:       q.Title,
-			AccessToken: t.AccessToken,
-		},
-	}.Do()
+	params := q.Values()
+	params.Set("access_token", t.AccessToken)
 
+	resp, err := cl.do(ctx, "GET", httpu.JoinURL(BaseURL, "items"), params, nil)
 	if err != nil {
 		return nil, err
 	}
 
+	defer resp.Body.Close()
+
 	if resp.StatusCode != 200 {
 		return nil, fmt.Errorf("Unexpected status code: %s", resp.Status)
 	}
 
-	m := &struct {
-		Items []Item `json:"items,omitempty"`
-	}{}
+	page := &ItemsPage{}
 
-	err = resp.Body.FromJsonTo(m)
+	err = json.NewDecoder(resp.Body).Decode(page)
 	if err != nil {
 		return nil, errors.WithStack(err)
 	}
 
-	return m.Items, nil
+	return page, nil
 }
 
-func (cl KinoPubClientImpl) GetItemById(id int) (*Item, error) {
+func (cl KinoPubClientImpl) GetItemById(ctx context.Context, id int) (*Item, error) {
 	cl.Logger.Debugf("Loading kinpub item by ID=%d", id)
 
-	cache := cl.CacheFactory.Get("KP_GetItemById", time.Hour)
-	cacheKey := fmt.Sprint(id)
+	cache := cl.CacheFactory.Get(ItemsCache, time.Hour)
 
 	item := &Item{}
+	err := provider.Fetch(ctx, cache, fmt.Sprint(id), item, func(ctx context.Context) (provider.CacheEntry, error) {
+		t, err := cl.getToken(ctx)
+		if err != nil {
+			return nil, errors.Wrap(err, "No auth")
+		}
 
-	if cache.Load(cacheKey, item) {
-		// cl.fixer.fixID(item)
-		return item, nil
-	}
+		cl.Logger.Debugln("Fetching kinpub item from the remote service")
+		resp, err := cl.do(ctx, "GET", httpu.JoinURL(BaseURL, "items", strconv.FormatInt(int64(id), 10)), url.Values{
+			"access_token": {t.AccessToken},
+		}, nil)
 
-	t, err := cl.getToken()
-	if err != nil {
-		return nil, errors.Wrap(err, "No auth")
-	}
+		if err != nil {
+			return nil, errors.WithMessage(err, "Can't fetch item")
+		}
 
-	cl.Logger.Debugln("Fetching kinpub item from the remote service")
-	resp, err := goreq.Request{
-		Method: "GET",
-		Uri:    httpu.JoinURL(BaseURL, "items", strconv.FormatInt(int64(id), 10)),
-		QueryString: struct {
-			AccessToken string `url:"access_token,omitempty"`
-		}{
-			AccessToken: t.AccessToken,
-		},
-	}.Do()
+		defer resp.Body.Close()
 
-	if err != nil {
-		return nil, errors.WithMessage(err, "Can't fetch item")
-	}
+		if resp.StatusCode != 200 {
+			return nil, fmt.Errorf("Unexpected status code: %s", resp.Status)
+		}
 
-	if resp.StatusCode != 200 {
-		return nil, fmt.Errorf("Unexpected status code: %s", resp.Status)
-	}
+		m := &struct {
+			Item Item `json:"item,omitempty"`
+		}{}
+
+		err = json.NewDecoder(resp.Body).Decode(m)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
 
-	m := &struct {
-		Item Item `json:"item,omitempty"`
-	}{}
+		return &m.Item, nil
+	})
 
-	err = resp.Body.FromJsonTo(m)
 	if err != nil {
-		return nil, errors.WithStack(err)
+		return nil, err
 	}
 
-	// cl.fixer.fixID(&m.Item)
+	return item, nil
+}
 
-	cache.Save(cacheKey, &m.Item)
+// errItemNotFound tells that the remote search has no matching item, so there is nothing to cache
+var errItemNotFound = errors.New("item not found")
 
-	return &m.Item, nil
-}
+// MatchItem finds kinopub item of the TMDB show or movie. Link overrides take precedence over the search.
+// As kinopub can't filter by id, the catalogue is searched by the titles and the candidates are scored.
+func (cl KinoPubClientImpl) MatchItem(ctx context.Context, q MatchQuery) (*Match, error) {
+	link := cl.Links.Get(q.Type, q.TMDBID)
+	if link == nil && q.ImdbID != 0 {
+		link = cl.Links.ByIMDB(q.ImdbID)
+	}
 
-// FindItemByIMDB search item by IMDB id. As there is no filter data by id, getch by title and then filter manually.
-func (cl KinoPubClientImpl) FindItemByIMDB(imdbID int, title string) (*Item, error) {
-	cache := cl.CacheFactory.Get("KP_FindItemByIMDB", time.Hour*24*7)
-	cacheKey := strconv.Itoa(imdbID)
+	if link != nil {
+		cl.Logger.Debugf("TMDB %s [%d] is linked to item [%d]", q.Type, q.TMDBID, link.KinopubID)
+		item, err := cl.GetItemById(ctx, link.KinopubID)
+		if err != nil {
+			return nil, err
+		}
+		return &Match{Item: item, Strategy: MatchByLink, Score: imdbMatchScore}, nil
+	}
 
-	item := &Item{}
+	cache := cl.CacheFactory.Get(MatchCache, time.Hour*24*7)
+	notFound := cl.CacheFactory.Get(MatchNotFoundCache, time.Hour*12)
+	cacheKey := matchCacheKey(q)
 
-	if cache.Load(cacheKey, item) {
-		return item, nil
+	if provider.IsMarkedNotFound(notFound, cacheKey) {
+		cl.Logger.Debugf("Item [%s] has not been found recently", cacheKey)
+		return nil, nil
 	}
 
-	title = truncateProblematicTitle(title)
-	cl.Logger.Debugf("Searching item by IMDB Id [%d, %s] on remote host.", imdbID, title)
-	items, err := cl.SearchItemBy(ItemsFilter{
-		Title: title,
+	match := &Match{}
+	err := provider.Fetch(ctx, cache, cacheKey, provider.Cacheable(match), func(ctx context.Context) (provider.CacheEntry, error) {
+		cl.Logger.Debugf("Matching item [%s, %s] on remote host.", cacheKey, q.OriginalTitle)
+		m, err := matchItem(ctx, q, cl.SearchItemBy)
+		if err != nil {
+			return nil, err
+		}
+
+		if m == nil {
+			return nil, errItemNotFound
+		}
+
+		cl.Logger.Debugf("Item [%s] matched to [%d] by %s \"%s\" with score %d", cacheKey, m.Item.ID, m.Strategy, m.Search, m.Score)
+		return provider.Cacheable(m), nil
 	})
 
+	if err == errItemNotFound {
+		if err = provider.MarkNotFound(notFound, cacheKey); err != nil {
+			cl.Logger.Errorf("Cannot cache missing item [%s]: %s", cacheKey, err.Error())
+		}
+		return nil, nil
+	}
+
 	if err != nil {
-		return nil, errors.WithMessage(err, "Can't find item")
+		return nil, err
+	}
+
+	return match, nil
+}
+
+// ForgetMatch drops cached result of the lookup, so the next lookup goes to the remote service.
+// Results cached by both IMDB and TMDB ids are dropped.
+func (cl KinoPubClientImpl) ForgetMatch(q MatchQuery) error {
+	keys := []string{matchCacheKey(q)}
+	if q.ImdbID != 0 && q.TMDBID != 0 {
+		keys = append(keys, matchCacheKey(MatchQuery{Type: q.Type, TMDBID: q.TMDBID}))
 	}
 
-	for _, item := range items {
-		if item.Imdb == imdbID {
-			cache.Save(cacheKey, &item)
-			return &item, nil
+	for _, key := range keys {
+		if err := provider.Forget(cl.CacheFactory, MatchCache, key); err != nil {
+			return err
+		}
+
+		if err := provider.Forget(cl.CacheFactory, MatchNotFoundCache, key); err != nil {
+			return err
 		}
 	}
 
-	return nil, nil
+	return nil
+}
+
+// matchCacheKey is IMDB id if known, so the lookups of the same title share the result
+func matchCacheKey(q MatchQuery) string {
+	if q.ImdbID != 0 {
+		return strconv.Itoa(q.ImdbID)
+	}
+	return fmt.Sprintf("%s/%d", q.Type, q.TMDBID)
 }
 
 // GetEpisode returns kinopub episode structure by season number (1-based) and episode number (1-based)
-func (cl KinoPubClientImpl) GetEpisode(imdbID int, title string, seasonNum int, episodeNum int) (interface{}, error) {
-	item, err := cl.FindItemByIMDB(imdbID, title)
+func (cl KinoPubClientImpl) GetEpisode(ctx context.Context, q MatchQuery, seasonNum int, episodeNum int) (*Episode, error) {
+	match, err := cl.MatchItem(ctx, q)
 	if err != nil {
 		return nil, err
 	}
 
-	if item == nil {
+	if match == nil {
 		return nil, nil
 	}
 
-	cl.Logger.Debugf("Found %s. Query: %s", title, item.Title)
-
-	it, err := cl.GetItemById(int(item.ID))
+	it, err := cl.GetItemById(ctx, int(match.Item.ID))
 	if err != nil {
 		return nil, errors.WithMessage(err, "Can't load kinopub item by id")
 	}
 
-	cl.Logger.Debugf("Kinpub Item %d has been loaded", item.ID)
-	for _, season := range it.Seasons {
-		if season.Number != seasonNum {
-			continue
-		}
-
-		for _, episode := range season.Episodes {
-			if episode.Number == episodeNum {
-				return episode, nil
-			}
-		}
-	}
-	return nil, nil
+	cl.Logger.Debugf("Kinpub Item %d has been loaded", match.Item.ID)
+	return it.Episode(seasonNum, episodeNum), nil
 }
 
 // NewKinoPubClient returns new kinopub client
 func NewKinoPubClient(logger *logrus.Logger, cf provider.CacheFactory) KinoPubClient {
+	storage := provider.JSONPreferenceStorage{
+		Path: ".data/",
+	}
+	log := logger.WithFields(logrus.Fields{"prefix": "kinpub"})
+
 	return KinoPubClientImpl{
-		ClientID:     os.Getenv("KINOPUB_CLIENT_ID"),
-		ClientSecret: os.Getenv("KINOPUB_CLIENT_SECRET"),
-		PreferenceStorage: provider.JSONPreferenceStorage{
-			Path: ".data/",
-		},
-		CacheFactory: cf,
-		Logger:       logger.WithFields(logrus.Fields{"prefix": "kinpub"}),
-		fixer:        &fixer{logger: logger.WithFields(logrus.Fields{"prefix": "id-fixer"})},
+		ClientID:          os.Getenv("KINOPUB_CLIENT_ID"),
+		ClientSecret:      os.Getenv("KINOPUB_CLIENT_SECRET"),
+		PreferenceStorage: storage,
+		CacheFactory:      cf,
+		Tokens:            NewTokenManager(storage, DefaultRefreshMargin, log),
+		Logger:            log,
 	}
 }
 
@@ -322,10 +402,3 @@ func ParseUID(uid string) (int, error) {
 
 	return strconv.Atoi(strings.TrimLeft(uid, provider.IDTypeKinoHub))
 }
-
-func truncateProblematicTitle(title string) string {
-	if strings.HasPrefix(title, "Marvel's") {
-		return strings.TrimPrefix(title, "Marvel's")
-	}
-	return title
-}
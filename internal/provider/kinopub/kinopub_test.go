@@ -1,6 +1,16 @@
 package kinopub
 
-import "testing"
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	provider "github.com/dpfg/kinohub-core/internal/provider"
+	"github.com/sirupsen/logrus"
+)
 
 func TestParseUID(t *testing.T) {
 	type args struct {
@@ -29,3 +39,42 @@ func TestParseUID(t *testing.T) {
 		})
 	}
 }
+
+// rewriteTransport sends all the requests to the test server
+type rewriteTransport struct {
+	host string
+}
+
+func (rt rewriteTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req.URL.Scheme = "http"
+	req.URL.Host = rt.host
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+// newTestClient returns client authorized to call the handler in place of kinopub
+func newTestClient(t *testing.T, handler http.Handler) (KinoPubClientImpl, func()) {
+	srv := httptest.NewServer(handler)
+
+	dir, err := ioutil.TempDir("", "kinopub")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	storage := provider.JSONPreferenceStorage{Path: dir}
+	if err = storage.Save(KinoPubPrefKey, &Token{AccessToken: "test-token", RefreshToken: "r1", ExpiresAt: time.Now().Add(time.Hour)}); err != nil {
+		t.Fatal(err)
+	}
+
+	logger := logrus.NewEntry(logrus.StandardLogger())
+	cl := KinoPubClientImpl{
+		PreferenceStorage: storage,
+		Tokens:            NewTokenManager(storage, 0, logger),
+		HTTP:              &http.Client{Transport: rewriteTransport{host: srv.Listener.Addr().String()}},
+		Logger:            logger,
+	}
+
+	return cl, func() {
+		srv.Close()
+		os.RemoveAll(dir)
+	}
+}
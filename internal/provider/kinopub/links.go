@@ -0,0 +1,147 @@
+package kinopub
+
+import (
+	"sync"
+
+	provider "github.com/dpfg/kinohub-core/internal/provider"
+	"github.com/pkg/errors"
+)
+
+// Types of the TMDB entries a kinopub item can be linked to
+const (
+	LinkTypeTV    = "tv"
+	LinkTypeMovie = "movie"
+)
+
+// LinksPrefKey is the preferences key of the link overrides
+const LinksPrefKey = "kinopub-links"
+
+// Link overrides kinopub item matched to the TMDB show or movie
+type Link struct {
+	Type      string `json:"type"`
+	TMDBID    int    `json:"tmdb_id"`
+	ImdbID    string `json:"imdb_id,omitempty"`
+	KinopubID int    `json:"kinopub_id"`
+}
+
+// Validate checks that the link has known type and both ids
+func (l Link) Validate() error {
+	if l.Type != LinkTypeTV && l.Type != LinkTypeMovie {
+		return errors.Errorf("Unknown link type [%s]", l.Type)
+	}
+
+	if l.TMDBID <= 0 {
+		return errors.New("TMDB id is required")
+	}
+
+	if l.KinopubID <= 0 {
+		return errors.New("Kinopub id is required")
+	}
+
+	return nil
+}
+
+// LinkStore keeps link overrides in the preferences
+type LinkStore struct {
+	storage provider.PreferenceStorage
+
+	mu    sync.RWMutex
+	links []Link
+}
+
+// NewLinkStore loads link overrides from the preferences
+func NewLinkStore(storage provider.PreferenceStorage) *LinkStore {
+	links := make([]Link, 0)
+	if err := storage.Load(LinksPrefKey, &links); err != nil {
+		links = make([]Link, 0)
+	}
+
+	return &LinkStore{storage: storage, links: links}
+}
+
+// All returns all the link overrides
+func (ls *LinkStore) All() []Link {
+	ls.mu.RLock()
+	defer ls.mu.RUnlock()
+
+	return append([]Link{}, ls.links...)
+}
+
+// Get returns link of the TMDB entry if any
+func (ls *LinkStore) Get(linkType string, tmdbID int) *Link {
+	return ls.find(func(l Link) bool { return l.Type == linkType && l.TMDBID == tmdbID })
+}
+
+// ByIMDB returns link of the IMDB entry if any
+func (ls *LinkStore) ByIMDB(imdbID int) *Link {
+	return ls.find(func(l Link) bool { return l.ImdbID != "" && StripImdbID(l.ImdbID) == imdbID })
+}
+
+// Put creates or replaces link of the TMDB entry
+func (ls *LinkStore) Put(link Link) error {
+	if err := link.Validate(); err != nil {
+		return err
+	}
+
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+
+	links := make([]Link, 0, len(ls.links)+1)
+	for _, l := range ls.links {
+		if l.Type != link.Type || l.TMDBID != link.TMDBID {
+			links = append(links, l)
+		}
+	}
+	links = append(links, link)
+
+	return ls.save(links)
+}
+
+// Delete removes link of the TMDB entry. Returns the removed link or nil if there was none.
+func (ls *LinkStore) Delete(linkType string, tmdbID int) (*Link, error) {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+
+	var removed *Link
+	links := make([]Link, 0, len(ls.links))
+	for i, l := range ls.links {
+		if l.Type == linkType && l.TMDBID == tmdbID {
+			removed = &ls.links[i]
+			continue
+		}
+		links = append(links, l)
+	}
+
+	if removed == nil {
+		return nil, nil
+	}
+
+	return removed, ls.save(links)
+}
+
+func (ls *LinkStore) find(match func(l Link) bool) *Link {
+	if ls == nil {
+		return nil
+	}
+
+	ls.mu.RLock()
+	defer ls.mu.RUnlock()
+
+	for _, l := range ls.links {
+		if match(l) {
+			return &l
+		}
+	}
+
+	return nil
+}
+
+// save persists links and replaces the current ones. Must be called with the lock held.
+func (ls *LinkStore) save(links []Link) error {
+	if err := ls.storage.Save(LinksPrefKey, links); err != nil {
+		return errors.WithMessage(err, "Cannot save kinopub links")
+	}
+
+	ls.links = links
+	return nil
+}
@@ -0,0 +1,62 @@
+package kinopub
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	provider "github.com/dpfg/kinohub-core/internal/provider"
+)
+
+func TestLinkStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "links")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	storage := provider.JSONPreferenceStorage{Path: dir}
+
+	ls := NewLinkStore(storage)
+	if err = ls.Put(Link{Type: LinkTypeTV, TMDBID: 61889, ImdbID: "tt3322312", KinopubID: 10}); err != nil {
+		t.Fatal(err)
+	}
+
+	// replaces link of the same show
+	if err = ls.Put(Link{Type: LinkTypeTV, TMDBID: 61889, ImdbID: "tt3322312", KinopubID: 11}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = ls.Put(Link{Type: "episode", TMDBID: 1, KinopubID: 1}); err == nil {
+		t.Errorf("Expected unknown link type to be rejected")
+	}
+
+	// links survive restart
+	ls = NewLinkStore(storage)
+
+	if l := ls.Get(LinkTypeTV, 61889); l == nil || l.KinopubID != 11 {
+		t.Errorf("Unexpected link: %+v", l)
+	}
+
+	if l := ls.Get(LinkTypeMovie, 61889); l != nil {
+		t.Errorf("Expected no movie link, got %+v", l)
+	}
+
+	if l := ls.ByIMDB(3322312); l == nil || l.KinopubID != 11 {
+		t.Errorf("Unexpected link by IMDB id: %+v", l)
+	}
+
+	removed, err := ls.Delete(LinkTypeTV, 61889)
+	if err != nil || removed == nil || removed.KinopubID != 11 {
+		t.Errorf("Delete() = %+v, %v", removed, err)
+	}
+
+	if len(ls.All()) != 0 {
+		t.Errorf("Expected no links, got %+v", ls.All())
+	}
+
+	var nilStore *LinkStore
+	if l := nilStore.ByIMDB(3322312); l != nil {
+		t.Errorf("Expected nil store to have no links")
+	}
+}
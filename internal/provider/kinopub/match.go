@@ -0,0 +1,250 @@
+package kinopub
+
+import (
+	"context"
+	"strings"
+	"unicode"
+
+	"github.com/pkg/errors"
+)
+
+// Strategies the item can be matched by
+const (
+	MatchByLink           = "link"
+	MatchByOriginalTitle  = "original-title"
+	MatchByLocalizedTitle = "localized-title"
+	MatchByAltTitle       = "alt-title"
+	MatchByYear           = "year"
+)
+
+const (
+	// maxMatchSearches limits the number of searches of a single lookup
+	maxMatchSearches = 8
+	// maxMatchAltTitles limits the number of the alternative titles tried
+	maxMatchAltTitles = 3
+	// minMatchScore is the score a candidate without matching IMDB id needs to be accepted
+	minMatchScore = 50
+	// imdbMatchScore is given to the candidate with the same IMDB id. It always wins.
+	imdbMatchScore = 100
+)
+
+// MatchQuery describes TMDB show or movie to find on kinopub
+type MatchQuery struct {
+	// Type is either LinkTypeTV or LinkTypeMovie
+	Type           string   `json:"type"`
+	TMDBID         int      `json:"tmdb_id"`
+	ImdbID         int      `json:"imdb_id,omitempty"`
+	OriginalTitle  string   `json:"original_title,omitempty"`
+	LocalizedTitle string   `json:"localized_title,omitempty"`
+	AltTitles      []string `json:"alt_titles,omitempty"`
+	Year           int      `json:"year,omitempty"`
+}
+
+// Match is kinopub item found for the query
+type Match struct {
+	Item *Item `json:"item"`
+	// Strategy tells how the item has been found
+	Strategy string `json:"strategy"`
+	// Search is the title the item has been found by
+	Search string `json:"search,omitempty"`
+	Score  int    `json:"score"`
+}
+
+// searchAttempt is a single search of the kinopub catalogue
+type searchAttempt struct {
+	strategy string
+	filter   ItemsFilter
+}
+
+type searchFunc func(ctx context.Context, q ItemsFilter) (*ItemsPage, error)
+
+// matchItem searches kinopub with every strategy in turn and returns the best scored candidate.
+// Search stops as soon as the candidate with the same IMDB id is found.
+func matchItem(ctx context.Context, q MatchQuery, search searchFunc) (*Match, error) {
+	titles := queryTitles(q)
+
+	var best *Match
+	for _, attempt := range searchAttempts(q) {
+		page, err := search(ctx, attempt.filter)
+		if err != nil {
+			return nil, errors.WithMessage(err, "Can't find item")
+		}
+
+		for i := range page.Items {
+			item := &page.Items[i]
+			score, ok := scoreItem(q, titles, item)
+			if !ok || (best != nil && best.Score >= score) {
+				continue
+			}
+
+			best = &Match{Item: item, Strategy: attempt.strategy, Search: attempt.filter.Title, Score: score}
+		}
+
+		if best != nil && best.Score >= imdbMatchScore {
+			return best, nil
+		}
+	}
+
+	if best == nil || best.Score < minMatchScore {
+		return nil, nil
+	}
+
+	return best, nil
+}
+
+// searchAttempts lists searches in the order of the strategies without repeating the same search
+func searchAttempts(q MatchQuery) []searchAttempt {
+	attempts := make([]searchAttempt, 0, maxMatchSearches)
+	seen := make(map[string]bool)
+
+	add := func(strategy string, filter ItemsFilter) {
+		key := filter.Values().Encode()
+		if filter.Title == "" || seen[key] || len(attempts) >= maxMatchSearches {
+			return
+		}
+		seen[key] = true
+		attempts = append(attempts, searchAttempt{strategy: strategy, filter: filter})
+	}
+
+	for _, title := range titleVariants(q.OriginalTitle) {
+		add(MatchByOriginalTitle, ItemsFilter{Title: title})
+	}
+
+	for _, title := range titleVariants(q.LocalizedTitle) {
+		add(MatchByLocalizedTitle, ItemsFilter{Title: title})
+	}
+
+	alts := q.AltTitles
+	if len(alts) > maxMatchAltTitles {
+		alts = alts[:maxMatchAltTitles]
+	}
+
+	for _, title := range alts {
+		add(MatchByAltTitle, ItemsFilter{Title: strings.TrimSpace(title)})
+	}
+
+	// common titles return too many items to find the right one on the first page
+	if q.Year > 0 {
+		for _, title := range []string{q.OriginalTitle, q.LocalizedTitle} {
+			add(MatchByYear, ItemsFilter{Title: strings.TrimSpace(title), YearFrom: q.Year - 1, YearTo: q.Year + 1})
+		}
+	}
+
+	return attempts
+}
+
+// titleVariants returns title as is, without punctuation, without possessive prefix ("Marvel's") and without subtitle
+func titleVariants(title string) []string {
+	title = strings.TrimSpace(title)
+	if title == "" {
+		return nil
+	}
+
+	variants := []string{title}
+	if plain := strings.Join(strings.Fields(stripPunctuation(title)), " "); plain != "" {
+		variants = append(variants, plain)
+	}
+
+	words := strings.Fields(title)
+	if len(words) > 1 && isPossessive(words[0]) {
+		variants = append(variants, strings.Join(words[1:], " "))
+	}
+
+	if i := strings.IndexAny(title, ":("); i > 0 {
+		variants = append(variants, strings.TrimSpace(title[:i]))
+	}
+
+	return variants
+}
+
+func isPossessive(word string) bool {
+	return strings.HasSuffix(word, "'s") || strings.HasSuffix(word, "’s")
+}
+
+// queryTitles returns normalized titles the item title is compared to
+func queryTitles(q MatchQuery) []string {
+	all := append([]string{q.OriginalTitle, q.LocalizedTitle}, q.AltTitles...)
+	if words := strings.Fields(q.OriginalTitle); len(words) > 1 && isPossessive(words[0]) {
+		all = append(all, strings.Join(words[1:], " "))
+	}
+
+	titles := make([]string, 0, len(all))
+	for _, t := range all {
+		if n := NormalizeTitle(t); n != "" {
+			titles = append(titles, n)
+		}
+	}
+
+	return titles
+}
+
+// scoreItem rates how likely the item is the one requested. Items with different IMDB id are rejected.
+func scoreItem(q MatchQuery, titles []string, item *Item) (int, bool) {
+	if q.ImdbID != 0 && item.Imdb != 0 {
+		if q.ImdbID != item.Imdb {
+			return 0, false
+		}
+		return imdbMatchScore, true
+	}
+
+	score := 0
+	switch diff := item.Year - q.Year; {
+	case q.Year == 0 || item.Year == 0:
+	case diff == 0:
+		score += 20
+	case diff == 1 || diff == -1:
+		score += 10
+	default:
+		score -= 20
+	}
+
+	score += scoreTitle(titles, item.Title)
+
+	if (q.Type == LinkTypeTV) != isSerialType(item.Type) {
+		score -= 30
+	}
+
+	return score, true
+}
+
+// scoreTitle compares normalized titles. Kinopub titles are "Localized / Original".
+func scoreTitle(titles []string, itemTitle string) int {
+	score := 0
+	for _, part := range strings.Split(itemTitle, "/") {
+		part = NormalizeTitle(part)
+		if part == "" {
+			continue
+		}
+
+		for _, t := range titles {
+			switch {
+			case t == part:
+				return 30
+			case strings.Contains(t, part) || strings.Contains(part, t):
+				score = 10
+			}
+		}
+	}
+
+	return score
+}
+
+func isSerialType(t string) bool {
+	return t == ItemTypeSerial || t == "docuserial" || t == "tvshow"
+}
+
+// NormalizeTitle lowercases title, drops apostrophes and replaces other punctuation with spaces
+func NormalizeTitle(title string) string {
+	title = strings.ToLower(title)
+	title = strings.NewReplacer("'", "", "’", "", "ё", "е", "&", " and ").Replace(title)
+	return strings.Join(strings.Fields(stripPunctuation(title)), " ")
+}
+
+func stripPunctuation(title string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) || r == '\'' || r == '’' {
+			return r
+		}
+		return ' '
+	}, title)
+}
@@ -0,0 +1,153 @@
+package kinopub
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+// testCatalogue answers searches by the title and year range
+type testCatalogue map[string][]Item
+
+func (c testCatalogue) search(searches *[]string) searchFunc {
+	return func(ctx context.Context, q ItemsFilter) (*ItemsPage, error) {
+		key := q.Title
+		if q.YearFrom > 0 {
+			key = fmt.Sprintf("%s %d-%d", q.Title, q.YearFrom, q.YearTo)
+		}
+		*searches = append(*searches, key)
+
+		if key == "error" {
+			return nil, errors.New("search failed")
+		}
+
+		return &ItemsPage{Items: c[key]}, nil
+	}
+}
+
+func TestMatchItem(t *testing.T) {
+	daredevil := Item{ID: 1, Type: ItemTypeSerial, Title: "Сорвиголова / Daredevil", Year: 2015, Imdb: 3322312}
+	daredevil2003 := Item{ID: 2, Type: ItemTypeMovie, Title: "Сорвиголова / Daredevil", Year: 2003, Imdb: 287978}
+	witcher := Item{ID: 3, Type: ItemTypeSerial, Title: "Ведьмак / The Witcher", Year: 2019}
+	dark := Item{ID: 4, Type: ItemTypeSerial, Title: "Тьма / Dark", Year: 2017, Imdb: 5753856}
+	darkOther := Item{ID: 5, Type: ItemTypeSerial, Title: "Тьма / Dark", Year: 2005}
+
+	catalogue := testCatalogue{
+		"Daredevil":      {daredevil2003, daredevil},
+		"Ведьмак":        {witcher},
+		"Dark":           {darkOther},
+		"Dark 2016-2018": {dark},
+		"Мрак":           {darkOther},
+	}
+
+	tests := []struct {
+		name         string
+		q            MatchQuery
+		wantID       int
+		wantStrategy string
+		wantSearches int
+		wantErr      bool
+	}{
+		{
+			name:         "Possessive prefix",
+			q:            MatchQuery{Type: LinkTypeTV, ImdbID: 3322312, OriginalTitle: "Marvel's Daredevil", Year: 2015},
+			wantID:       1,
+			wantStrategy: MatchByOriginalTitle,
+			wantSearches: 2,
+		},
+		{
+			name:         "Localized title",
+			q:            MatchQuery{Type: LinkTypeTV, OriginalTitle: "The Witcher: Season", LocalizedTitle: "Ведьмак", Year: 2019},
+			wantID:       3,
+			wantStrategy: MatchByLocalizedTitle,
+		},
+		{
+			name:         "Alternative title",
+			q:            MatchQuery{Type: LinkTypeTV, ImdbID: 4, OriginalTitle: "Wiedźmin", AltTitles: []string{"Ведьмак"}, Year: 2019},
+			wantID:       3,
+			wantStrategy: MatchByAltTitle,
+		},
+		{
+			name:         "Year constrained",
+			q:            MatchQuery{Type: LinkTypeTV, ImdbID: 5753856, OriginalTitle: "Dark", LocalizedTitle: "Тьма", Year: 2017},
+			wantID:       4,
+			wantStrategy: MatchByYear,
+		},
+		{
+			name: "Different IMDB id",
+			q:    MatchQuery{Type: LinkTypeMovie, ImdbID: 42, OriginalTitle: "Daredevil", Year: 2003},
+		},
+		{
+			name: "Title only",
+			q:    MatchQuery{Type: LinkTypeTV, LocalizedTitle: "Мрак"},
+		},
+		{
+			name: "Nothing found",
+			q:    MatchQuery{Type: LinkTypeMovie, OriginalTitle: "Marvel's Unknown: Story", LocalizedTitle: "Неизвестный", AltTitles: []string{"a", "b", "c", "d"}, Year: 2000},
+			// attempts are capped
+			wantSearches: maxMatchSearches,
+		},
+		{
+			name:    "Search error",
+			q:       MatchQuery{Type: LinkTypeMovie, OriginalTitle: "error"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			searches := make([]string, 0)
+			got, err := matchItem(context.Background(), tt.q, catalogue.search(&searches))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("matchItem() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			gotID, gotStrategy := 0, ""
+			if got != nil {
+				gotID, gotStrategy = got.Item.ID, got.Strategy
+			}
+
+			if gotID != tt.wantID || gotStrategy != tt.wantStrategy {
+				t.Errorf("matchItem() = %d by %q, want %d by %q (searches %q)", gotID, gotStrategy, tt.wantID, tt.wantStrategy, searches)
+			}
+
+			if tt.wantSearches > 0 && len(searches) != tt.wantSearches {
+				t.Errorf("matchItem() searched %q, want %d searches", searches, tt.wantSearches)
+			}
+		})
+	}
+}
+
+func TestNormalizeTitle(t *testing.T) {
+	tests := []struct {
+		title string
+		want  string
+	}{
+		{title: "Marvel's Agents of S.H.I.E.L.D.", want: "marvels agents of s h i e l d"},
+		{title: "Law & Order: SVU", want: "law and order svu"},
+		{title: " Ёлки  ", want: "елки"},
+		{title: "Marvel’s Daredevil", want: "marvels daredevil"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.title, func(t *testing.T) {
+			if got := NormalizeTitle(tt.title); got != tt.want {
+				t.Errorf("NormalizeTitle() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTitleVariants(t *testing.T) {
+	got := fmt.Sprint(titleVariants("Marvel's Agents of S.H.I.E.L.D.: Slingshot"))
+	want := fmt.Sprint([]string{
+		"Marvel's Agents of S.H.I.E.L.D.: Slingshot",
+		"Marvel's Agents of S H I E L D Slingshot",
+		"Agents of S.H.I.E.L.D.: Slingshot",
+		"Marvel's Agents of S.H.I.E.L.D.",
+	})
+
+	if got != want {
+		t.Errorf("titleVariants() = %s, want %s", got, want)
+	}
+}
@@ -2,6 +2,7 @@ package kinopub
 
 import (
 	"encoding/json"
+	"fmt"
 	util2 "github.com/dpfg/kinohub-core/pkg/util"
 	"strconv"
 
@@ -53,42 +54,164 @@ type Item struct {
 		ID  int    `json:"id"`
 		URL string `json:"url"`
 	} `json:"trailer"`
-	Finished    bool          `json:"finished"`
-	Advert      bool          `json:"advert"`
-	PoorQuality bool          `json:"poor_quality"`
-	InWatchlist bool          `json:"in_watchlist"`
-	Subscribed  bool          `json:"subscribed"`
-	Subtitles   string        `json:"subtitles"`
-	Bookmarks   []interface{} `json:"bookmarks"`
-	Ac3         int           `json:"ac3"`
-	Seasons     []struct {
-		Title    string `json:"title"`
-		Number   int    `json:"number"`
-		Watching struct {
-			Status int `json:"status"`
-		} `json:"watching"`
-		Episodes []struct {
-			ID        int    `json:"id"`
-			Title     string `json:"title"`
-			Thumbnail string `json:"thumbnail"`
-			Duration  int    `json:"duration"`
-			Tracks    int    `json:"tracks"`
-			Number    int    `json:"number"`
-			Ac3       int    `json:"ac3"`
-			Watched   int    `json:"watched"`
-			Watching  struct {
-				Status int `json:"status"`
-				Time   int `json:"time"`
-			} `json:"watching"`
-			Subtitles []struct {
-				Lang  string `json:"lang"`
-				Shift int    `json:"shift"`
-				Embed bool   `json:"embed"`
-				URL   string `json:"url"`
-			} `json:"subtitles"`
-			Files []File `json:"files"`
-		} `json:"episodes"`
-	} `json:"seasons"`
+	Finished    bool   `json:"finished"`
+	Advert      bool   `json:"advert"`
+	PoorQuality bool   `json:"poor_quality"`
+	InWatchlist bool   `json:"in_watchlist"`
+	Subscribed  bool   `json:"subscribed"`
+	Subtitles   string `json:"subtitles"`
+	// Bookmarks is kept undecoded: kinopub doesn't document its shape, and a mismatch
+	// would break decoding of the whole item. Folders are loaded by GetBookmarkFolders.
+	Bookmarks json.RawMessage `json:"bookmarks"`
+	Ac3       int             `json:"ac3"`
+	Seasons   []Season        `json:"seasons"`
+	// Videos of the movie. Usually there is a single one.
+	Videos []Episode `json:"videos"`
+}
+
+// Season of the kinopub serial
+type Season struct {
+	Title    string `json:"title"`
+	Number   int    `json:"number"`
+	Watching struct {
+		Status int `json:"status"`
+	} `json:"watching"`
+	Episodes []Episode `json:"episodes"`
+}
+
+// Episode of the kinopub serial
+type Episode struct {
+	ID        int    `json:"id"`
+	Title     string `json:"title"`
+	Thumbnail string `json:"thumbnail"`
+	// Duration in seconds
+	Duration int `json:"duration"`
+	Tracks   int `json:"tracks"`
+	Number   int `json:"number"`
+	Ac3      int `json:"ac3"`
+	Watched  int `json:"watched"`
+	Watching struct {
+		Status int `json:"status"`
+		Time   int `json:"time"`
+	} `json:"watching"`
+	Subtitles []Subtitle `json:"subtitles"`
+	Audios    []Audio    `json:"audios"`
+	Files     []File     `json:"files"`
+}
+
+// Subtitle of the video
+type Subtitle struct {
+	Lang  string `json:"lang"`
+	Shift int    `json:"shift"`
+	Embed bool   `json:"embed"`
+	URL   string `json:"url"`
+}
+
+// Watching statuses of the episode or season
+const (
+	WatchingStatusUnwatched = -1
+	WatchingStatusWatching  = 0
+	WatchingStatusWatched   = 1
+)
+
+// Season returns season by number (1-based)
+func (item Item) Season(seasonNum int) *Season {
+	for i := range item.Seasons {
+		if item.Seasons[i].Number == seasonNum {
+			return &item.Seasons[i]
+		}
+	}
+
+	return nil
+}
+
+// Audio track of the video
+type Audio struct {
+	ID       int    `json:"id"`
+	Index    int    `json:"index"`
+	Codec    string `json:"codec"`
+	Channels int    `json:"channels"`
+	Lang     string `json:"lang"`
+	// Type of the translation, e.g. dubbing or voice-over
+	Type *struct {
+		ID    int    `json:"id"`
+		Title string `json:"title"`
+	} `json:"type"`
+	// Author of the translation
+	Author *struct {
+		ID    int    `json:"id"`
+		Title string `json:"title"`
+	} `json:"author"`
+}
+
+// ToDomainSubtitles converts subtitle tracks
+func ToDomainSubtitles(subtitles []Subtitle) []domain.Subtitle {
+	r := make([]domain.Subtitle, 0, len(subtitles))
+	for _, s := range subtitles {
+		r = append(r, domain.Subtitle{
+			Lang:     s.Lang,
+			URL:      s.URL,
+			Shift:    s.Shift,
+			Embedded: s.Embed,
+		})
+	}
+	return r
+}
+
+// ToDomainAudioTracks converts audio tracks. Title of the track names the translation, e.g. "Dubbing (LostFilm)".
+func ToDomainAudioTracks(audios []Audio) []domain.AudioTrack {
+	r := make([]domain.AudioTrack, 0, len(audios))
+	for _, a := range audios {
+		title := ""
+		if a.Type != nil {
+			title = a.Type.Title
+		}
+
+		if a.Author != nil && a.Author.Title != "" {
+			if title == "" {
+				title = a.Author.Title
+			} else {
+				title = fmt.Sprintf("%s (%s)", title, a.Author.Title)
+			}
+		}
+
+		r = append(r, domain.AudioTrack{
+			Index:    a.Index,
+			Lang:     a.Lang,
+			Title:    title,
+			Codec:    a.Codec,
+			Channels: a.Channels,
+		})
+	}
+	return r
+}
+
+// Episode returns episode by season number (1-based) and episode number (1-based)
+func (item Item) Episode(seasonNum int, episodeNum int) *Episode {
+	season := item.Season(seasonNum)
+	if season == nil {
+		return nil
+	}
+
+	for i := range season.Episodes {
+		if season.Episodes[i].Number == episodeNum {
+			return &season.Episodes[i]
+		}
+	}
+
+	return nil
+}
+
+// ToDomainWatchStatus converts kinopub watching status
+func ToDomainWatchStatus(status int) string {
+	switch status {
+	case WatchingStatusWatched:
+		return domain.WatchStatusWatched
+	case WatchingStatusWatching:
+		return domain.WatchStatusWatching
+	default:
+		return domain.WatchStatusUnwatched
+	}
 }
 
 func (item Item) ToDomain() *domain.Series {
@@ -100,10 +223,22 @@ func (item Item) ToDomain() *domain.Series {
 	}
 }
 
+// ToDomainMovie converts item of the movie type
+func (item Item) ToDomainMovie() *domain.Movie {
+	return &domain.Movie{
+		UID:        ToUID(item.ID),
+		Title:      item.Title,
+		Year:       item.Year,
+		Overview:   item.Plot,
+		PosterPath: item.Posters.Big,
+	}
+}
+
 type File struct {
 	W       int    `json:"w"`
 	H       int    `json:"h"`
 	Quality string `json:"quality"`
+	Codec   string `json:"codec"`
 	URL     struct {
 		HTTP string `json:"http"`
 		Hls  string `json:"hls"`
@@ -116,6 +251,9 @@ func ToDomainFiles(files []File) []domain.File {
 	for _, f := range files {
 		r = append(r, domain.File{
 			Quality: f.Quality,
+			Width:   f.W,
+			Height:  f.H,
+			Codec:   f.Codec,
 			URL:     f.URL,
 		})
 	}
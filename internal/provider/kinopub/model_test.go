@@ -1,6 +1,11 @@
 package kinopub
 
-import "testing"
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/dpfg/kinohub-core/domain"
+)
 
 func TestItem_ImdbID(t *testing.T) {
 	item := Item{Imdb: 898266}
@@ -8,3 +13,88 @@ func TestItem_ImdbID(t *testing.T) {
 		t.Errorf("Invalid IMDB ID: %s. Expected tt0898266.", item.ImdbID())
 	}
 }
+
+func TestItem_Episode(t *testing.T) {
+	item := Item{Seasons: []Season{
+		{Number: 2, Episodes: []Episode{{ID: 21, Number: 1}, {ID: 23, Number: 3}}},
+	}}
+
+	if e := item.Episode(2, 3); e == nil || e.ID != 23 {
+		t.Errorf("Expected episode 23, got %+v", e)
+	}
+
+	if e := item.Episode(2, 2); e != nil {
+		t.Errorf("Expected missing episode, got %+v", e)
+	}
+
+	if e := item.Episode(1, 1); e != nil {
+		t.Errorf("Expected missing season, got %+v", e)
+	}
+}
+
+func TestToDomainWatchStatus(t *testing.T) {
+	tests := []struct {
+		status int
+		want   string
+	}{
+		{status: WatchingStatusUnwatched, want: domain.WatchStatusUnwatched},
+		{status: WatchingStatusWatching, want: domain.WatchStatusWatching},
+		{status: WatchingStatusWatched, want: domain.WatchStatusWatched},
+	}
+	for _, tt := range tests {
+		if got := ToDomainWatchStatus(tt.status); got != tt.want {
+			t.Errorf("ToDomainWatchStatus(%d) = %v, want %v", tt.status, got, tt.want)
+		}
+	}
+}
+
+func TestToDomainAudioTracks(t *testing.T) {
+	audios := make([]Audio, 3)
+	if err := json.Unmarshal([]byte(`[
+		{"index": 1, "lang": "rus", "codec": "aac", "channels": 2, "type": {"id": 1, "title": "Dubbing"}, "author": {"id": 7, "title": "LostFilm"}},
+		{"index": 2, "lang": "rus", "type": {"id": 2, "title": "Voice-over"}},
+		{"index": 3, "lang": "eng"}
+	]`), &audios); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"Dubbing (LostFilm)", "Voice-over", ""}
+	tracks := ToDomainAudioTracks(audios)
+	for i, track := range tracks {
+		if track.Title != want[i] || track.Index != i+1 {
+			t.Errorf("Unexpected track %d: %+v", i, track)
+		}
+	}
+}
+
+func TestItem_UnmarshalBookmarks(t *testing.T) {
+	tests := []struct {
+		name      string
+		bookmarks string
+	}{
+		{name: "Folders", bookmarks: `[{"id": 1, "title": "Family", "views": 0, "count": 2, "created": 1546300800, "updated": 1546300800}]`},
+		{name: "Folder ids", bookmarks: `[1, 2]`},
+		{name: "Object", bookmarks: `{"1": "Family"}`},
+		{name: "Empty", bookmarks: `[]`},
+		{name: "Null", bookmarks: `null`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := `{"item": {"id": 8930, "type": "serial", "title": "Теория большого взрыва / The Big Bang Theory",
+				"year": 2007, "imdb": 898266, "in_watchlist": true, "subscribed": false,
+				"bookmarks": ` + tt.bookmarks + `, "seasons": [{"number": 1, "episodes": [{"id": 1, "number": 1}]}]}}`
+
+			m := &struct {
+				Item Item `json:"item"`
+			}{}
+
+			if err := json.Unmarshal([]byte(data), m); err != nil {
+				t.Fatalf("Cannot decode item with bookmarks %s: %v", tt.bookmarks, err)
+			}
+
+			if m.Item.ID != 8930 || m.Item.Imdb != 898266 || len(m.Item.Seasons) != 1 {
+				t.Errorf("Unexpected item: %+v", m.Item)
+			}
+		})
+	}
+}
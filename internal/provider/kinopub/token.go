@@ -0,0 +1,241 @@
+package kinopub
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	provider "github.com/dpfg/kinohub-core/internal/provider"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// DefaultRefreshMargin is how long before the expiration the token is refreshed
+const DefaultRefreshMargin = 10 * time.Minute
+
+// refreshTimeout bounds the refresh that is detached from the caller's context
+const refreshTimeout = 30 * time.Second
+
+// refreshRetryDelay is how long the token that is still valid is used after the failed refresh
+const refreshRetryDelay = time.Minute
+
+// ErrNoToken tells that the device hasn't been authorized yet
+var ErrNoToken = errors.New("kinopub device is not authorized")
+
+// States of the token
+const (
+	TokenMissing  = "missing"
+	TokenValid    = "valid"
+	TokenExpiring = "expiring"
+	TokenExpired  = "expired"
+)
+
+// TokenStatus describes health of the token without revealing it
+type TokenStatus struct {
+	State       string     `json:"state"`
+	ExpiresAt   *time.Time `json:"expires_at,omitempty"`
+	LastRefresh *time.Time `json:"last_refresh,omitempty"`
+	// Refreshes counts the tokens received since the start
+	Refreshes int    `json:"refreshes"`
+	LastError string `json:"last_error,omitempty"`
+}
+
+// refreshFunc exchanges refresh token for the new token
+type refreshFunc func(ctx context.Context, refreshToken string) (*Token, error)
+
+// TokenManager keeps the token in memory and refreshes it shortly before it expires.
+// Refreshes are serialized, as every refresh invalidates the previous refresh token.
+type TokenManager struct {
+	storage provider.PreferenceStorage
+	margin  time.Duration
+	logger  *logrus.Entry
+
+	// lock is held while the token is loaded or refreshed. Channel lets the waiters give up with their context.
+	lock chan struct{}
+
+	mu          sync.Mutex
+	token       *Token
+	lastRefresh time.Time
+	refreshes   int
+	lastErr     error
+	// nextAttempt delays the refresh after the failure unless the token has expired
+	nextAttempt time.Time
+}
+
+// NewTokenManager creates manager of the token persisted in the storage.
+// Zero margin means DefaultRefreshMargin.
+func NewTokenManager(storage provider.PreferenceStorage, margin time.Duration, logger *logrus.Entry) *TokenManager {
+	if margin <= 0 {
+		margin = DefaultRefreshMargin
+	}
+
+	return &TokenManager{
+		storage: storage,
+		margin:  margin,
+		logger:  logger,
+		lock:    make(chan struct{}, 1),
+	}
+}
+
+// Token returns access token, refreshing it if it's about to expire. The token that
+// is still valid is returned even if the refresh fails, and the refresh is retried later.
+func (tm *TokenManager) Token(ctx context.Context, refresh refreshFunc) (*Token, error) {
+	if t := tm.current(); t != nil && tm.usable(t, time.Now()) {
+		return t, nil
+	}
+
+	select {
+	case tm.lock <- struct{}{}:
+		defer func() { <-tm.lock }()
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	// another caller might have refreshed it while this one was waiting
+	t := tm.current()
+	if t != nil && tm.usable(t, time.Now()) {
+		return t, nil
+	}
+
+	// the token might have been replaced in the storage, e.g. by the auth command
+	stored := &Token{}
+	if err := tm.storage.Load(KinoPubPrefKey, stored); err == nil && (t == nil || stored.ExpiresAt.After(t.ExpiresAt)) {
+		tm.set(stored)
+		t = stored
+	}
+
+	if t == nil || t.RefreshToken == "" {
+		return nil, ErrNoToken
+	}
+
+	if tm.usable(t, time.Now()) {
+		return t, nil
+	}
+
+	// kinopub rotates refresh token, so the result must not be lost if the caller goes away
+	rctx, cancel := context.WithTimeout(context.Background(), refreshTimeout)
+	defer cancel()
+
+	tm.logger.Debugf("Refreshing token that expires at %s", t.ExpiresAt.Format(time.RFC3339))
+	nt, err := refresh(rctx, t.RefreshToken)
+	if err != nil {
+		tm.failed(err)
+		if t.ExpiresAt.After(time.Now()) {
+			tm.logger.Warnf("Cannot refresh token, using the current one: %s", err.Error())
+			return t, nil
+		}
+		return nil, errors.WithMessage(err, "Unable to refresh access token")
+	}
+
+	// the previous refresh token is no longer valid, so the new one is used even if it's not persisted
+	if err := tm.Save(nt); err != nil {
+		tm.logger.Errorf("Refreshed token will be lost on restart: %s", err.Error())
+	}
+
+	return nt, nil
+}
+
+// Save makes the token current and persists it. The token is kept in memory even if it can't be persisted.
+func (tm *TokenManager) Save(t *Token) error {
+	tm.mu.Lock()
+	tm.token = t
+	tm.lastRefresh = time.Now()
+	tm.refreshes++
+	tm.lastErr = nil
+	tm.nextAttempt = time.Time{}
+	tm.mu.Unlock()
+
+	if err := tm.storage.Save(KinoPubPrefKey, t); err != nil {
+		err = errors.Wrap(err, "Unable to save access token")
+
+		tm.mu.Lock()
+		tm.lastErr = err
+		tm.mu.Unlock()
+		return err
+	}
+
+	return nil
+}
+
+// Status describes the current token
+func (tm *TokenManager) Status() TokenStatus {
+	t := tm.current()
+	if t == nil {
+		// nothing has been requested since the start, so the stored token is described
+		stored := &Token{}
+		if err := tm.storage.Load(KinoPubPrefKey, stored); err == nil && stored.RefreshToken != "" {
+			t = stored
+		}
+	}
+
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+
+	status := TokenStatus{State: TokenMissing, Refreshes: tm.refreshes}
+	if !tm.lastRefresh.IsZero() {
+		lastRefresh := tm.lastRefresh
+		status.LastRefresh = &lastRefresh
+	}
+
+	if tm.lastErr != nil {
+		status.LastError = tm.lastErr.Error()
+	}
+
+	if t == nil {
+		return status
+	}
+
+	expiresAt := t.ExpiresAt
+	status.ExpiresAt = &expiresAt
+
+	now := time.Now()
+	switch {
+	case !t.ExpiresAt.After(now):
+		status.State = TokenExpired
+	case !tm.fresh(t, now):
+		status.State = TokenExpiring
+	default:
+		status.State = TokenValid
+	}
+
+	return status
+}
+
+func (tm *TokenManager) current() *Token {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+
+	return tm.token
+}
+
+func (tm *TokenManager) set(t *Token) {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+
+	tm.token = t
+}
+
+func (tm *TokenManager) failed(err error) {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+
+	tm.lastErr = err
+	tm.nextAttempt = time.Now().Add(refreshRetryDelay)
+}
+
+// usable tells whether the token can be used without the refresh
+func (tm *TokenManager) usable(t *Token, now time.Time) bool {
+	if tm.fresh(t, now) {
+		return true
+	}
+
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+
+	return t.ExpiresAt.After(now) && now.Before(tm.nextAttempt)
+}
+
+// fresh tells whether the token is valid beyond the refresh margin
+func (tm *TokenManager) fresh(t *Token, now time.Time) bool {
+	return t.AccessToken != "" && t.ExpiresAt.After(now.Add(tm.margin))
+}
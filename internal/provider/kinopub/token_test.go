@@ -0,0 +1,213 @@
+package kinopub
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	provider "github.com/dpfg/kinohub-core/internal/provider"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+func TestTokenManager(t *testing.T) {
+	tests := []struct {
+		name       string
+		stored     *Token
+		refreshErr error
+		wantAccess string
+		wantCalls  int32
+		wantState  string
+		wantErr    bool
+	}{
+		{name: "Not authorized", wantErr: true, wantState: TokenMissing},
+		{
+			name:       "Fresh",
+			stored:     &Token{AccessToken: "a1", RefreshToken: "r1", ExpiresAt: time.Now().Add(time.Hour)},
+			wantAccess: "a1",
+			wantState:  TokenValid,
+		},
+		{
+			name:       "Expiring",
+			stored:     &Token{AccessToken: "a1", RefreshToken: "r1", ExpiresAt: time.Now().Add(time.Minute)},
+			wantAccess: "a2",
+			wantCalls:  1,
+			wantState:  TokenValid,
+		},
+		{
+			name:       "Expired",
+			stored:     &Token{AccessToken: "a1", RefreshToken: "r1", ExpiresAt: time.Now().Add(-time.Minute)},
+			wantAccess: "a2",
+			wantCalls:  1,
+			wantState:  TokenValid,
+		},
+		{
+			name:       "Refresh of expiring fails",
+			stored:     &Token{AccessToken: "a1", RefreshToken: "r1", ExpiresAt: time.Now().Add(time.Minute)},
+			refreshErr: errors.New("refresh failed"),
+			wantAccess: "a1",
+			wantCalls:  1,
+			wantState:  TokenExpiring,
+		},
+		{
+			name:       "Refresh of expired fails",
+			stored:     &Token{AccessToken: "a1", RefreshToken: "r1", ExpiresAt: time.Now().Add(-time.Minute)},
+			refreshErr: errors.New("refresh failed"),
+			wantCalls:  1,
+			wantState:  TokenExpired,
+			wantErr:    true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "tokens")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(dir)
+
+			storage := provider.JSONPreferenceStorage{Path: dir}
+			if tt.stored != nil {
+				if err = storage.Save(KinoPubPrefKey, tt.stored); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			var calls int32
+			refresh := func(ctx context.Context, refreshToken string) (*Token, error) {
+				atomic.AddInt32(&calls, 1)
+				// concurrent callers wait for the refresh
+				time.Sleep(10 * time.Millisecond)
+				if tt.refreshErr != nil {
+					return nil, tt.refreshErr
+				}
+				return &Token{AccessToken: "a2", RefreshToken: "r2", ExpiresAt: time.Now().Add(time.Hour)}, nil
+			}
+
+			tm := NewTokenManager(storage, 5*time.Minute, logrus.NewEntry(logrus.StandardLogger()))
+
+			var wg sync.WaitGroup
+			for i := 0; i < 5; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+
+					got, err := tm.Token(context.Background(), refresh)
+					if (err != nil) != tt.wantErr {
+						t.Errorf("Token() error = %v, wantErr %v", err, tt.wantErr)
+						return
+					}
+
+					if err == nil && got.AccessToken != tt.wantAccess {
+						t.Errorf("Token() = %s, want %s", got.AccessToken, tt.wantAccess)
+					}
+				}()
+			}
+			wg.Wait()
+
+			// every caller retries the refresh of the expired token, as there is nothing to fall back to
+			if got := atomic.LoadInt32(&calls); got < tt.wantCalls || (tt.wantState != TokenExpired && got != tt.wantCalls) {
+				t.Errorf("Refreshes = %d, want %d", got, tt.wantCalls)
+			}
+
+			if got := tm.Status().State; got != tt.wantState {
+				t.Errorf("Status() = %s, want %s", got, tt.wantState)
+			}
+
+			if tt.refreshErr == nil && tt.wantCalls > 0 {
+				// the refreshed token survives restart
+				stored := &Token{}
+				if err = storage.Load(KinoPubPrefKey, stored); err != nil || stored.RefreshToken != "r2" {
+					t.Errorf("Stored token = %+v, %v", stored, err)
+				}
+			}
+		})
+	}
+}
+
+func TestTokenManager_CancelledWaiter(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tokens")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	storage := provider.JSONPreferenceStorage{Path: dir}
+	if err = storage.Save(KinoPubPrefKey, &Token{AccessToken: "a1", RefreshToken: "r1"}); err != nil {
+		t.Fatal(err)
+	}
+
+	tm := NewTokenManager(storage, 0, logrus.NewEntry(logrus.StandardLogger()))
+
+	release := make(chan struct{})
+	refresh := func(ctx context.Context, refreshToken string) (*Token, error) {
+		<-release
+		return &Token{AccessToken: "a2", RefreshToken: "r2", ExpiresAt: time.Now().Add(time.Hour)}, nil
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		tm.Token(context.Background(), refresh)
+	}()
+
+	// wait for the first caller to start the refresh
+	for len(tm.lock) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := tm.Token(ctx, refresh); err != context.Canceled {
+		t.Errorf("Token() error = %v, want %v", err, context.Canceled)
+	}
+
+	close(release)
+	<-done
+}
+
+// readOnlyStorage loads the token, but can't save it
+type readOnlyStorage struct {
+	token Token
+}
+
+func (s readOnlyStorage) Load(key string, value interface{}) error {
+	*value.(*Token) = s.token
+	return nil
+}
+
+func (s readOnlyStorage) Save(key string, value interface{}) error {
+	return errors.New("disk is full")
+}
+
+func TestTokenManager_SaveFails(t *testing.T) {
+	storage := readOnlyStorage{token: Token{AccessToken: "a1", RefreshToken: "r1", ExpiresAt: time.Now().Add(-time.Minute)}}
+	tm := NewTokenManager(storage, 0, logrus.NewEntry(logrus.StandardLogger()))
+
+	var calls int32
+	refresh := func(ctx context.Context, refreshToken string) (*Token, error) {
+		atomic.AddInt32(&calls, 1)
+		return &Token{AccessToken: "a2", RefreshToken: "r2", ExpiresAt: time.Now().Add(time.Hour)}, nil
+	}
+
+	for i := 0; i < 2; i++ {
+		got, err := tm.Token(context.Background(), refresh)
+		if err != nil || got.AccessToken != "a2" {
+			t.Fatalf("Token() = %+v, %v, want a2", got, err)
+		}
+	}
+
+	// the rotated refresh token is kept in memory, so it's not refreshed again
+	if calls != 1 {
+		t.Errorf("Refreshes = %d, want 1", calls)
+	}
+
+	if status := tm.Status(); status.State != TokenValid || status.LastError == "" {
+		t.Errorf("Status() = %+v, want valid with the save error", status)
+	}
+}
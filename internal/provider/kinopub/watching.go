@@ -0,0 +1,102 @@
+package kinopub
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	provider "github.com/dpfg/kinohub-core/internal/provider"
+	httpu "github.com/dpfg/kinohub-core/pkg/http"
+	"github.com/pkg/errors"
+)
+
+// MarkEpisodeWatched marks episode of the serial as watched or unwatched.
+// Kinopub only toggles the status, so it's changed only if it differs from the requested one.
+func (cl KinoPubClientImpl) MarkEpisodeWatched(ctx context.Context, itemID int, seasonNum int, episodeNum int, watched bool) error {
+	item, err := cl.reloadItem(ctx, itemID)
+	if err != nil {
+		return err
+	}
+
+	episode := item.Episode(seasonNum, episodeNum)
+	if episode == nil {
+		return errors.Errorf("Episode S%02dE%02d of item [%d] is not found", seasonNum, episodeNum, itemID)
+	}
+
+	if (episode.Watching.Status == WatchingStatusWatched) == watched {
+		return nil
+	}
+
+	return cl.callWatching(ctx, itemID, "toggle", url.Values{
+		"season": {strconv.Itoa(seasonNum)},
+		"video":  {strconv.Itoa(episodeNum)},
+	})
+}
+
+// MarkSeasonWatched marks all the episodes of the season as watched or unwatched
+func (cl KinoPubClientImpl) MarkSeasonWatched(ctx context.Context, itemID int, seasonNum int, watched bool) error {
+	item, err := cl.reloadItem(ctx, itemID)
+	if err != nil {
+		return err
+	}
+
+	season := item.Season(seasonNum)
+	if season == nil {
+		return errors.Errorf("Season %d of item [%d] is not found", seasonNum, itemID)
+	}
+
+	if (season.Watching.Status == WatchingStatusWatched) == watched {
+		return nil
+	}
+
+	return cl.callWatching(ctx, itemID, "toggle", url.Values{
+		"season": {strconv.Itoa(seasonNum)},
+	})
+}
+
+// SaveEpisodePosition stores position in seconds to resume the episode from
+func (cl KinoPubClientImpl) SaveEpisodePosition(ctx context.Context, itemID int, seasonNum int, episodeNum int, position int) error {
+	if position < 0 {
+		return errors.Errorf("Invalid position [%d]", position)
+	}
+
+	return cl.callWatching(ctx, itemID, "marktime", url.Values{
+		"season": {strconv.Itoa(seasonNum)},
+		"video":  {strconv.Itoa(episodeNum)},
+		"time":   {strconv.Itoa(position)},
+	})
+}
+
+// reloadItem loads item bypassing the cache, so the watching status is up to date
+func (cl KinoPubClientImpl) reloadItem(ctx context.Context, itemID int) (*Item, error) {
+	if err := provider.Forget(cl.CacheFactory, ItemsCache, strconv.Itoa(itemID)); err != nil {
+		return nil, err
+	}
+
+	return cl.GetItemById(ctx, itemID)
+}
+
+// callWatching calls kinopub /watching API and drops the cached item with outdated status
+func (cl KinoPubClientImpl) callWatching(ctx context.Context, itemID int, action string, params url.Values) error {
+	t, err := cl.getToken(ctx)
+	if err != nil {
+		return errors.Wrap(err, "No auth")
+	}
+
+	params.Set("id", strconv.Itoa(itemID))
+	params.Set("access_token", t.AccessToken)
+
+	resp, err := cl.do(ctx, "GET", httpu.JoinURL(BaseURL, "watching", action), params, nil)
+	if err != nil {
+		return errors.WithMessage(err, "Network error")
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return errors.Errorf("Cannot update watching status: service response - %s", resp.Status)
+	}
+
+	return provider.Forget(cl.CacheFactory, ItemsCache, strconv.Itoa(itemID))
+}
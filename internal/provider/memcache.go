@@ -0,0 +1,147 @@
+package providers
+
+import (
+	"container/list"
+	"sync"
+)
+
+// MemoryStats describes the state of the in-memory tier of a named cache.
+type MemoryStats struct {
+	Entries   int    `json:"entries"`
+	Bytes     int64  `json:"bytes"`
+	Hits      uint64 `json:"hits"`
+	Misses    uint64 `json:"misses"`
+	Evictions uint64 `json:"evictions"`
+}
+
+type lruItem struct {
+	key  string
+	data []byte
+}
+
+// lruCache is a bounded in-memory cache that evicts least recently used entries
+// once the number of entries or their total size exceeds the limits.
+// Zero limit means there is no restriction.
+type lruCache struct {
+	mu sync.Mutex
+
+	maxEntries int
+	maxBytes   int64
+
+	ll    *list.List
+	items map[string]*list.Element
+	stats MemoryStats
+}
+
+func newLRUCache(maxEntries int, maxBytes int64) *lruCache {
+	return &lruCache{
+		maxEntries: maxEntries,
+		maxBytes:   maxBytes,
+		ll:         list.New(),
+		items:      make(map[string]*list.Element),
+	}
+}
+
+func (c *lruCache) Save(key string, value CacheEntry) error {
+	data, err := value.MarshalBinary()
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.maxBytes > 0 && int64(len(key)+len(data)) > c.maxBytes {
+		// entry would never fit, so drop a stale copy if any
+		c.remove(key)
+		return nil
+	}
+
+	if el, ok := c.items[key]; ok {
+		item := el.Value.(*lruItem)
+		c.stats.Bytes += int64(len(data) - len(item.data))
+		item.data = data
+		c.ll.MoveToFront(el)
+	} else {
+		c.items[key] = c.ll.PushFront(&lruItem{key: key, data: data})
+		c.stats.Bytes += int64(len(key) + len(data))
+		c.stats.Entries++
+	}
+
+	for c.overflows() {
+		c.removeElement(c.ll.Back())
+		c.stats.Evictions++
+	}
+
+	return nil
+}
+
+func (c *lruCache) Load(key string, value CacheEntry) (bool, error) {
+	c.mu.Lock()
+	el, ok := c.items[key]
+	if !ok {
+		c.stats.Misses++
+		c.mu.Unlock()
+		return false, nil
+	}
+
+	c.ll.MoveToFront(el)
+	c.stats.Hits++
+	data := el.Value.(*lruItem).data
+	c.mu.Unlock()
+
+	if err := value.UnmarshalBinary(data); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// Delete removes entry with provided key
+func (c *lruCache) Delete(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.remove(key)
+}
+
+// Clear removes all entries but keeps collected counters
+func (c *lruCache) Clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.ll.Init()
+	c.items = make(map[string]*list.Element)
+	c.stats.Entries = 0
+	c.stats.Bytes = 0
+}
+
+// Stats returns a snapshot of the cache counters
+func (c *lruCache) Stats() MemoryStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.stats
+}
+
+func (c *lruCache) overflows() bool {
+	if c.ll.Len() == 0 {
+		return false
+	}
+
+	return (c.maxEntries > 0 && c.stats.Entries > c.maxEntries) ||
+		(c.maxBytes > 0 && c.stats.Bytes > c.maxBytes)
+}
+
+func (c *lruCache) remove(key string) {
+	if el, ok := c.items[key]; ok {
+		c.removeElement(el)
+	}
+}
+
+func (c *lruCache) removeElement(el *list.Element) {
+	item := c.ll.Remove(el).(*lruItem)
+	delete(c.items, item.key)
+	c.stats.Bytes -= int64(len(item.key) + len(item.data))
+	c.stats.Entries--
+}
@@ -0,0 +1,113 @@
+package providers
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+)
+
+type testEntry struct {
+	data []byte
+}
+
+func (e *testEntry) MarshalBinary() ([]byte, error) {
+	return e.data, nil
+}
+
+func (e *testEntry) UnmarshalBinary(data []byte) error {
+	e.data = append([]byte{}, data...)
+	return nil
+}
+
+func loaded(c Cache, key string, value CacheEntry) bool {
+	found, err := c.Load(key, value)
+	return found && err == nil
+}
+
+func TestLRUCache_EvictsByEntries(t *testing.T) {
+	c := newLRUCache(2, 0)
+
+	c.Save("a", &testEntry{data: []byte("1")})
+	c.Save("b", &testEntry{data: []byte("2")})
+
+	// touch "a" so "b" becomes the least recently used one
+	c.Load("a", &testEntry{})
+
+	c.Save("c", &testEntry{data: []byte("3")})
+
+	if loaded(c, "b", &testEntry{}) {
+		t.Errorf("Expected [b] to be evicted")
+	}
+
+	for _, key := range []string{"a", "c"} {
+		if !loaded(c, key, &testEntry{}) {
+			t.Errorf("Expected [%s] to stay in cache", key)
+		}
+	}
+
+	stats := c.Stats()
+	if stats.Entries != 2 || stats.Evictions != 1 {
+		t.Errorf("Unexpected stats: %+v", stats)
+	}
+}
+
+func TestLRUCache_EvictsByBytes(t *testing.T) {
+	c := newLRUCache(0, 9)
+
+	c.Save("a", &testEntry{data: []byte("1234")})
+	c.Save("b", &testEntry{data: []byte("1234")})
+
+	if loaded(c, "a", &testEntry{}) {
+		t.Errorf("Expected [a] to be evicted")
+	}
+
+	c.Save("c", &testEntry{data: []byte("too large to fit")})
+	if loaded(c, "c", &testEntry{}) {
+		t.Errorf("Expected [c] not to be cached")
+	}
+
+	if stats := c.Stats(); stats.Bytes != 5 {
+		t.Errorf("Unexpected size of cache: %d", stats.Bytes)
+	}
+}
+
+func TestLRUCache_UpdateAndDelete(t *testing.T) {
+	c := newLRUCache(0, 0)
+
+	c.Save("a", &testEntry{data: []byte("1")})
+	c.Save("a", &testEntry{data: []byte("123")})
+
+	e := &testEntry{}
+	if !loaded(c, "a", e) || string(e.data) != "123" {
+		t.Errorf("Expected updated value, got: %s", e.data)
+	}
+
+	c.Delete("a")
+
+	stats := c.Stats()
+	if stats.Entries != 0 || stats.Bytes != 0 || stats.Hits != 1 {
+		t.Errorf("Unexpected stats: %+v", stats)
+	}
+}
+
+func TestLRUCache_ConcurrentAccess(t *testing.T) {
+	c := newLRUCache(50, 0)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 200; j++ {
+				key := strconv.Itoa((i * j) % 80)
+				c.Save(key, &testEntry{data: []byte(key)})
+				c.Load(key, &testEntry{})
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if stats := c.Stats(); stats.Entries > 50 {
+		t.Errorf("Cache exceeds the limit: %d", stats.Entries)
+	}
+}
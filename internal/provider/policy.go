@@ -0,0 +1,98 @@
+package providers
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// CachePolicy overrides defaults of a named cache
+type CachePolicy struct {
+	// TTL replaces the expiration time requested by the cache user. Zero keeps the requested one.
+	TTL time.Duration
+	// MaxEntries limits number of entries of the cache. Memory tier never exceeds it, entries
+	// on disk over the limit are removed by the sweeper. Zero keeps the global memory limit.
+	MaxEntries int
+	// NoCache disables caching of the entries
+	NoCache bool
+}
+
+// ParseCachePolicy parses policy definition in the form of
+// NAME:ttl=2h,max-entries=100 or NAME:no-cache
+func ParseCachePolicy(def string) (string, CachePolicy, error) {
+	policy := CachePolicy{}
+
+	sep := strings.Index(def, ":")
+	if sep <= 0 {
+		return "", policy, errors.Errorf("Invalid cache policy [%s]: cache name is missing", def)
+	}
+
+	name := strings.TrimSpace(def[:sep])
+	for _, opt := range strings.Split(def[sep+1:], ",") {
+		opt = strings.TrimSpace(opt)
+		if opt == "" {
+			continue
+		}
+
+		kv := strings.SplitN(opt, "=", 2)
+		switch {
+		case kv[0] == "no-cache" && len(kv) == 1:
+			policy.NoCache = true
+		case kv[0] == "ttl" && len(kv) == 2:
+			ttl, err := time.ParseDuration(kv[1])
+			if err != nil {
+				return "", policy, errors.Wrapf(err, "Invalid TTL of cache policy [%s]", def)
+			}
+			if ttl < 0 {
+				return "", policy, errors.Errorf("Invalid TTL of cache policy [%s]: must not be negative", def)
+			}
+			policy.TTL = ttl
+		case kv[0] == "max-entries" && len(kv) == 2:
+			n, err := strconv.Atoi(kv[1])
+			if err != nil {
+				return "", policy, errors.Wrapf(err, "Invalid max entries of cache policy [%s]", def)
+			}
+			if n < 0 {
+				return "", policy, errors.Errorf("Invalid max entries of cache policy [%s]: must not be negative", def)
+			}
+			policy.MaxEntries = n
+		default:
+			return "", policy, errors.Errorf("Invalid cache policy [%s]: unknown option [%s]", def, opt)
+		}
+	}
+
+	return name, policy, nil
+}
+
+// ParseCachePolicies parses list of policy definitions
+func ParseCachePolicies(defs []string) (map[string]CachePolicy, error) {
+	policies := make(map[string]CachePolicy, len(defs))
+	for _, def := range defs {
+		name, policy, err := ParseCachePolicy(def)
+		if err != nil {
+			return nil, err
+		}
+		policies[name] = policy
+	}
+
+	return policies, nil
+}
+
+// noCache is used for the caches disabled by policy
+type noCache struct {
+	name string
+}
+
+func (c noCache) Save(key string, value CacheEntry) error {
+	return nil
+}
+
+func (c noCache) Load(key string, value CacheEntry) (bool, error) {
+	return false, nil
+}
+
+func (c noCache) flightID(key string) string {
+	return c.name + "/" + key
+}
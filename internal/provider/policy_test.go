@@ -0,0 +1,94 @@
+package providers
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseCachePolicy(t *testing.T) {
+	tests := []struct {
+		name       string
+		def        string
+		wantName   string
+		wantPolicy CachePolicy
+		wantErr    bool
+	}{
+		{name: "TTL", def: "KP_GetItemById:ttl=2h", wantName: "KP_GetItemById", wantPolicy: CachePolicy{TTL: 2 * time.Hour}},
+		{name: "All options", def: "TMDB_ENTITIES: ttl=30m, max-entries=100", wantName: "TMDB_ENTITIES", wantPolicy: CachePolicy{TTL: 30 * time.Minute, MaxEntries: 100}},
+		{name: "No cache", def: "KP_FindItemByIMDB:no-cache", wantName: "KP_FindItemByIMDB", wantPolicy: CachePolicy{NoCache: true}},
+		{name: "Missing name", def: ":ttl=1h", wantErr: true},
+		{name: "Invalid TTL", def: "TMDB_ENTITIES:ttl=day", wantErr: true},
+		{name: "Unknown option", def: "TMDB_ENTITIES:size=1", wantErr: true},
+		{name: "Negative TTL", def: "TMDB_ENTITIES:ttl=-1h", wantErr: true},
+		{name: "Negative max entries", def: "TMDB_ENTITIES:max-entries=-1", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			name, policy, err := ParseCachePolicy(tt.def)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ParseCachePolicy() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if name != tt.wantName || !reflect.DeepEqual(policy, tt.wantPolicy) {
+				t.Errorf("ParseCachePolicy() = %v, %+v, want %v, %+v", name, policy, tt.wantName, tt.wantPolicy)
+			}
+		})
+	}
+}
+
+func TestStandardCacheManager_Policies(t *testing.T) {
+	scm, cleanup := newTestCacheManager(t, CacheOptions{Policies: map[string]CachePolicy{
+		"disabled": {NoCache: true},
+		"short":    {TTL: time.Nanosecond},
+	}})
+	defer cleanup()
+
+	disabled := scm.Get("disabled", time.Hour)
+	disabled.Save("key", &testEntry{data: []byte("value")})
+	if loaded(disabled, "key", &testEntry{}) {
+		t.Errorf("Expected disabled cache to keep nothing")
+	}
+
+	short := scm.Get("short", time.Hour)
+	short.Save("key", &testEntry{data: []byte("value")})
+	time.Sleep(time.Millisecond)
+	if loaded(short, "key", &testEntry{}) {
+		t.Errorf("Expected policy TTL to override requested one")
+	}
+}
+
+func TestStandardCacheManager_SweepMaxEntries(t *testing.T) {
+	scm, cleanup := newTestCacheManager(t, CacheOptions{Policies: map[string]CachePolicy{
+		"capped": {MaxEntries: 3},
+	}})
+	defer cleanup()
+
+	for i := 0; i < 10; i++ {
+		ttl := time.Duration(i+1) * time.Minute
+		scm.Get("capped", ttl).Save(fmt.Sprintf("key-%d", i), &testEntry{data: []byte("value")})
+		scm.Get("other", ttl).Save(fmt.Sprintf("key-%d", i), &testEntry{data: []byte("value")})
+	}
+
+	report, err := scm.Sweep()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if report.Evicted != 7 {
+		t.Errorf("Evicted = %d, want 7", report.Evicted)
+	}
+
+	// entries that expire soonest are evicted first
+	for i := 0; i < 10; i++ {
+		key := fmt.Sprintf("key-%d", i)
+		if got := persisted(scm, "capped", key); got != (i >= 7) {
+			t.Errorf("Entry [capped/%s] persisted = %v", key, got)
+		}
+
+		if !persisted(scm, "other", key) {
+			t.Errorf("Expected entry [other/%s] without limit to be kept", key)
+		}
+	}
+}
@@ -62,7 +62,8 @@ func (jts JSONPreferenceStorage) Load(key string, value interface{}) error {
 	return nil
 }
 
-// Save token to json file.
+// Save writes value to json file. The file is replaced atomically, so a crash
+// in the middle of the write doesn't leave it truncated.
 func (jts JSONPreferenceStorage) Save(key string, value interface{}) error {
 	dat, err := json.Marshal(value)
 	if err != nil {
@@ -70,10 +71,27 @@ func (jts JSONPreferenceStorage) Save(key string, value interface{}) error {
 	}
 
 	filePath := jts.getFilePath(key)
-	err = ensureFileExists(filePath)
+	tmp, err := ioutil.TempFile(path.Dir(filePath), key+".*.tmp")
 	if err != nil {
 		return err
 	}
 
-	return ioutil.WriteFile(filePath, dat, os.ModeExclusive)
+	// no-op once the file is renamed
+	defer os.Remove(tmp.Name())
+
+	if _, err = tmp.Write(dat); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err = tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), filePath)
 }
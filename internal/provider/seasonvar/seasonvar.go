@@ -1,44 +1,67 @@
 package seasonvar
 
 import (
+	"context"
+	"encoding/json"
+	"net/http"
 	"net/url"
 	"os"
+	"time"
 
-	"github.com/franela/goreq"
+	httpu "github.com/dpfg/kinohub-core/pkg/http"
+	"github.com/pkg/errors"
 )
 
 // Client provides access to Seasonvar API
 type Client interface {
-	Search(q string) ([]interface{}, error)
+	Search(ctx context.Context, q string) ([]interface{}, error)
 }
 
 // BaseURL points to the SeasonVar API entry point
 const BaseURL = "http://api.seasonvar.ru/"
 
+// HTTPOptions configures resilience of the requests to the Seasonvar API
+var HTTPOptions = httpu.TransportOptions{
+	Name:             "seasonvar",
+	Timeout:          15 * time.Second,
+	MaxRetries:       2,
+	MinBackoff:       500 * time.Millisecond,
+	MaxBackoff:       5 * time.Second,
+	MaxRetryAfter:    10 * time.Second,
+	BreakerThreshold: 5,
+	BreakerCooldown:  time.Minute,
+}
+
 type clientImpl struct {
 	apiKey string
+	http   *http.Client
 }
 
-func (cl clientImpl) Search(q string) ([]interface{}, error) {
+func (cl clientImpl) Search(ctx context.Context, q string) ([]interface{}, error) {
 	params := url.Values{}
 
 	params.Set("command", "search")
 	params.Set("key", cl.apiKey)
 	params.Set("query", q)
 
-	resp, err := goreq.Request{
-		Method:      "POST",
-		ContentType: "application/x-www-form-urlencoded",
-		Uri:         BaseURL,
-		Body:        params.Encode(),
-	}.Do()
+	req, err := httpu.NewRequest(ctx, "POST", BaseURL, nil, params)
+	if err != nil {
+		return nil, err
+	}
 
+	resp, err := cl.http.Do(req)
 	if err != nil {
 		return []interface{}{}, err
 	}
 
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("Unexpected status code: %s", resp.Status)
+	}
+
 	var data []interface{}
-	err = resp.Body.FromJsonTo(&data)
+	err = json.NewDecoder(resp.Body).Decode(&data)
 	if err != nil {
 		return nil, err
 	}
@@ -47,9 +70,11 @@ func (cl clientImpl) Search(q string) ([]interface{}, error) {
 
 }
 
-// NewClient create new instance of seasonvar client
+// NewClient create new instance of seasonvar client. The client is built from HTTPOptions as is:
+// the server doesn't use Seasonvar, so there is no timeout flag to apply.
 func NewClient() Client {
 	return &clientImpl{
 		apiKey: os.Getenv("SV_API_KEY"),
+		http:   httpu.NewClient(HTTPOptions),
 	}
 }
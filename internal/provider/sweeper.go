@@ -0,0 +1,197 @@
+package providers
+
+import (
+	"sort"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/pkg/errors"
+)
+
+const (
+	// sizeCapTarget is a share of the size limit to shrink the cache to once the limit is exceeded.
+	// It leaves room for the bolt page overhead, growth of the file by powers of two and new entries.
+	sizeCapTarget = 0.5
+
+	// minCompactSize prevents compaction of small databases where the wasted space is negligible
+	minCompactSize = 1 << 20
+)
+
+// SweepReport summarizes a single run of the cache sweeper
+type SweepReport struct {
+	// Expired is the number of removed expired or unreadable entries
+	Expired int `json:"expired"`
+	// Evicted is the number of live entries removed to meet the entries or size limits
+	Evicted int `json:"evicted"`
+	// Compacted tells whether the database file has been rewritten
+	Compacted bool `json:"compacted"`
+	// FileSize is the size of the database file after the sweep
+	FileSize int64 `json:"file_size"`
+}
+
+type sweepEntry struct {
+	bucket    []byte
+	key       []byte
+	size      int64
+	expiresAt time.Time
+}
+
+func (scm *StandardCacheManager) runSweeper(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		report, err := scm.Sweep()
+		if err != nil {
+			scm.logger.Errorf("Cache sweep failed: %s", err.Error())
+			continue
+		}
+
+		scm.logger.Infof("Cache sweep: expired=%d evicted=%d compacted=%t size=%d",
+			report.Expired, report.Evicted, report.Compacted, report.FileSize)
+	}
+}
+
+// Sweep removes expired entries from the cache database. Entries are kept
+// after expiration as long as they can be served stale. Caches over the
+// entries limit of their policy and the database over the size limit lose
+// the entries that expire soonest as well.
+// The file is compacted when it holds too much free space.
+func (scm *StandardCacheManager) Sweep() (*SweepReport, error) {
+	scm.sweepMu.Lock()
+	defer scm.sweepMu.Unlock()
+
+	report := &SweepReport{}
+	if scm.store == nil {
+		return report, nil
+	}
+
+	expired, live, err := scm.scanEntries(time.Now().Add(-scm.opts.retention()))
+	if err != nil {
+		return nil, errors.WithMessage(err, "Cannot scan cache")
+	}
+
+	if err = scm.deleteEntries(expired); err != nil {
+		return nil, errors.WithMessage(err, "Cannot delete expired entries")
+	}
+	report.Expired = len(expired)
+
+	live, capped := scm.capEntries(live)
+	if err = scm.deleteEntries(capped); err != nil {
+		return nil, errors.WithMessage(err, "Cannot evict entries over the limit")
+	}
+	report.Evicted = len(capped)
+
+	var liveBytes int64
+	for _, e := range live {
+		liveBytes += e.size
+	}
+
+	fileSize, err := scm.store.FileSize()
+	if err != nil {
+		return nil, err
+	}
+
+	overflow := scm.opts.MaxFileSize > 0 && fileSize > scm.opts.MaxFileSize
+	if overflow {
+		sort.Slice(live, func(i, j int) bool { return live[i].expiresAt.Before(live[j].expiresAt) })
+
+		target := int64(float64(scm.opts.MaxFileSize) * sizeCapTarget)
+		evicted := 0
+		for ; evicted < len(live) && liveBytes > target; evicted++ {
+			liveBytes -= live[evicted].size
+		}
+
+		if err = scm.deleteEntries(live[:evicted]); err != nil {
+			return nil, errors.WithMessage(err, "Cannot evict entries")
+		}
+		report.Evicted += evicted
+	}
+
+	removed := report.Expired+report.Evicted > 0
+	wasteful := fileSize > minCompactSize && fileSize > 2*liveBytes
+	if removed && (overflow || wasteful) {
+		if err = scm.store.Compact(); err != nil {
+			return nil, errors.WithMessage(err, "Cannot compact cache")
+		}
+		report.Compacted = true
+
+		if fileSize, err = scm.store.FileSize(); err != nil {
+			return nil, err
+		}
+	}
+
+	report.FileSize = fileSize
+	return report, nil
+}
+
+// scanEntries splits all the persisted entries into ones expired before the deadline and live ones
+func (scm *StandardCacheManager) scanEntries(deadline time.Time) (expired []sweepEntry, live []sweepEntry, err error) {
+	err = scm.store.View(func(tx *bolt.Tx) error {
+		return tx.ForEach(func(name []byte, bucket *bolt.Bucket) error {
+			return bucket.ForEach(func(k, v []byte) error {
+				entry := sweepEntry{
+					bucket: append([]byte{}, name...),
+					key:    append([]byte{}, k...),
+					size:   int64(len(k) + len(v)),
+				}
+
+				env := &envelope{}
+				if err := env.UnmarshalBinary(v); err != nil || env.expiresAt.Before(deadline) {
+					expired = append(expired, entry)
+					return nil
+				}
+
+				entry.expiresAt = env.expiresAt
+				live = append(live, entry)
+				return nil
+			})
+		})
+	})
+
+	return expired, live, err
+}
+
+// capEntries splits live entries into the kept ones and the ones over the entries limit of their cache
+func (scm *StandardCacheManager) capEntries(live []sweepEntry) (kept []sweepEntry, capped []sweepEntry) {
+	byCache := make(map[string][]sweepEntry)
+	for _, e := range live {
+		byCache[string(e.bucket)] = append(byCache[string(e.bucket)], e)
+	}
+
+	kept = make([]sweepEntry, 0, len(live))
+	for name, entries := range byCache {
+		limit := scm.opts.Policies[name].MaxEntries
+		if limit <= 0 || len(entries) <= limit {
+			kept = append(kept, entries...)
+			continue
+		}
+
+		sort.Slice(entries, func(i, j int) bool { return entries[i].expiresAt.Before(entries[j].expiresAt) })
+		capped = append(capped, entries[:len(entries)-limit]...)
+		kept = append(kept, entries[len(entries)-limit:]...)
+	}
+
+	return kept, capped
+}
+
+func (scm *StandardCacheManager) deleteEntries(entries []sweepEntry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+
+	return scm.store.Update(func(tx *bolt.Tx) error {
+		for _, e := range entries {
+			bucket := tx.Bucket(e.bucket)
+			if bucket == nil {
+				continue
+			}
+
+			if err := bucket.Delete(e.key); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
@@ -1,6 +1,9 @@
 package tmdb
 
 import (
+	"encoding/json"
+	"strconv"
+
 	"github.com/dpfg/kinohub-core/domain"
 )
 
@@ -59,6 +62,16 @@ func (show TVShow) ToDomain() *domain.Series {
 	}
 }
 
+// Airing tells whether new episodes of the show can still appear
+func (show TVShow) Airing() bool {
+	switch show.Status {
+	case "Ended", "Canceled":
+		return false
+	default:
+		return true
+	}
+}
+
 type TVSeason struct {
 	ID           int         `json:"id"`
 	AirDate      string      `json:"air_date"`
@@ -157,6 +170,7 @@ type Movie struct {
 	BackdropPath     interface{} `json:"backdrop_path"`
 	GenreIds         []int       `json:"genre_ids"`
 	ID               int         `json:"id"`
+	ImdbID           string      `json:"imdb_id"`
 	OriginalLanguage string      `json:"original_language"`
 	OriginalTitle    string      `json:"original_title"`
 	Overview         string      `json:"overview"`
@@ -171,6 +185,7 @@ type Movie struct {
 
 func (m *Movie) ToDomain() *domain.Movie {
 	return &domain.Movie{
+		UID:        ToUID(m.ID),
 		Title:      m.Title,
 		Overview:   m.Overview,
 		PosterPath: ImagePath(m.PosterPath, OriginalSize),
@@ -181,3 +196,121 @@ type SearchResult struct {
 	TVResults    []TVShow `json:"tv_results"`
 	MovieResults []Movie  `json:"movie_results"`
 }
+
+// Empty tells whether nothing has been found
+func (sr SearchResult) Empty() bool {
+	return len(sr.TVResults) == 0 && len(sr.MovieResults) == 0
+}
+
+func (sr SearchResult) MarshalBinary() (data []byte, err error) {
+	return json.Marshal(sr)
+}
+
+func (sr *SearchResult) UnmarshalBinary(data []byte) error {
+	return json.Unmarshal(data, sr)
+}
+
+// AlternativeTitle is a title of TV show or movie in the country
+type AlternativeTitle struct {
+	Country string `json:"iso_3166_1"`
+	Title   string `json:"title"`
+	Type    string `json:"type"`
+}
+
+// AlternativeTitles lists titles of TV show (results) or movie (titles)
+type AlternativeTitles struct {
+	ID      int                `json:"id"`
+	Results []AlternativeTitle `json:"results,omitempty"`
+	Titles  []AlternativeTitle `json:"titles,omitempty"`
+}
+
+// ByCountry returns distinct titles of the countries in the given order followed by the rest of titles
+func (at AlternativeTitles) ByCountry(countries ...string) []string {
+	all := at.all()
+
+	seen := make(map[string]bool)
+	titles := make([]string, 0, len(all))
+	add := func(t AlternativeTitle) {
+		if t.Title == "" || seen[t.Title] {
+			return
+		}
+		seen[t.Title] = true
+		titles = append(titles, t.Title)
+	}
+
+	for _, country := range countries {
+		for _, t := range all {
+			if t.Country == country {
+				add(t)
+			}
+		}
+	}
+
+	for _, t := range all {
+		add(t)
+	}
+
+	return titles
+}
+
+// InCountry returns titles of the country
+func (at AlternativeTitles) InCountry(country string) []string {
+	titles := make([]string, 0)
+	for _, t := range at.all() {
+		if t.Country == country && t.Title != "" {
+			titles = append(titles, t.Title)
+		}
+	}
+	return titles
+}
+
+func (at AlternativeTitles) all() []AlternativeTitle {
+	return append(append([]AlternativeTitle{}, at.Results...), at.Titles...)
+}
+
+// MultiSearchResult is a TV show, movie or person found by the query
+type MultiSearchResult struct {
+	ID        int    `json:"id"`
+	MediaType string `json:"media_type"`
+	// Name and OriginalName are set for TV shows and people
+	Name         string `json:"name,omitempty"`
+	OriginalName string `json:"original_name,omitempty"`
+	FirstAirDate string `json:"first_air_date,omitempty"`
+	// Title and OriginalTitle are set for movies
+	Title         string  `json:"title,omitempty"`
+	OriginalTitle string  `json:"original_title,omitempty"`
+	ReleaseDate   string  `json:"release_date,omitempty"`
+	PosterPath    string  `json:"poster_path,omitempty"`
+	Popularity    float64 `json:"popularity"`
+}
+
+// Titles returns the title and the original one of TV show or movie
+func (r MultiSearchResult) Titles() (string, string) {
+	if r.MediaType == MediaTypeMovie {
+		return r.Title, r.OriginalTitle
+	}
+	return r.Name, r.OriginalName
+}
+
+// Year returns year of the first air or release date or zero if unknown
+func (r MultiSearchResult) Year() int {
+	date := r.FirstAirDate
+	if r.MediaType == MediaTypeMovie {
+		date = r.ReleaseDate
+	}
+
+	if len(date) < 4 {
+		return 0
+	}
+
+	year, _ := strconv.Atoi(date[:4])
+	return year
+}
+
+// MultiSearchResults is a single page of the multi search
+type MultiSearchResults struct {
+	Page         int                 `json:"page"`
+	Results      []MultiSearchResult `json:"results"`
+	TotalPages   int                 `json:"total_pages"`
+	TotalResults int                 `json:"total_results"`
+}
@@ -1,7 +1,10 @@
 package tmdb
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
+	"io/ioutil"
 	"net/http"
 	"net/url"
 	"os"
@@ -12,7 +15,6 @@ import (
 	httpu "github.com/dpfg/kinohub-core/pkg/http"
 
 	provider "github.com/dpfg/kinohub-core/internal/provider"
-	"github.com/franela/goreq"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 )
@@ -20,25 +22,34 @@ import (
 // Client is an interface that describes capabilities of TMDB API.
 type Client interface {
 	// Get the primary TV show details by id.
-	GetTVShowByID(id int) (*TVShow, error)
+	GetTVShowByID(ctx context.Context, id int) (*TVShow, error)
 	// Get the external ids for a TV show
-	GetTVShowExternalIDS(id int) (*Ids, error)
+	GetTVShowExternalIDS(ctx context.Context, id int) (*Ids, error)
 	// Get the images that belong to a TV show.
-	GetTVShowImages(id int) (*ShowBackdrops, error)
+	GetTVShowImages(ctx context.Context, id int) (*ShowBackdrops, error)
 	//
-	GetTVSeason(id, seasonNum int) (*TVSeason, error)
+	GetTVSeason(ctx context.Context, id, seasonNum int) (*TVSeason, error)
 	// Get the TV episode details by id.
-	GetTVEpisode(tvID int, seasonNum int, episodeNum int) (*TVEpisode, error)
+	GetTVEpisode(ctx context.Context, tvID int, seasonNum int, episodeNum int) (*TVEpisode, error)
 	// Get the images that belong to a TV episode.
-	GetTVEpisodeImages(tvID int, seasonNum int, episodeNum int) (TVEpisodeStills, error)
+	GetTVEpisodeImages(ctx context.Context, tvID int, seasonNum int, episodeNum int) (TVEpisodeStills, error)
 
-	FindByExternalID(id string) (*SearchResult, error)
+	FindByExternalID(ctx context.Context, id string) (*SearchResult, error)
 
-	FindTVShowByExternalID(id string) (*TVShow, error)
+	FindTVShowByExternalID(ctx context.Context, id string) (*TVShow, error)
 
-	FindMovieByExternalID(id string) (*Movie, error)
+	FindMovieByExternalID(ctx context.Context, id string) (*Movie, error)
 
-	Movie(id int) (*Movie, error)
+	// ForgetExternalID drops cached result of the search by external id, found or not.
+	ForgetExternalID(id string) error
+
+	Movie(ctx context.Context, id int) (*Movie, error)
+
+	// Get the titles the TV show or movie is known by in the other countries.
+	GetAlternativeTitles(ctx context.Context, mediaType string, id int) (*AlternativeTitles, error)
+
+	// Search for TV shows, movies and people in a single request. Page is 1-based.
+	SearchMulti(ctx context.Context, query string, page int) (*MultiSearchResults, error)
 }
 
 const (
@@ -55,56 +66,108 @@ type ClientImpl struct {
 	Logger            *logrus.Entry
 	Cache             provider.CacheFactory
 	PreferenceStorage provider.PreferenceStorage
+	// HTTP overrides the default client, see HTTPOptions
+	HTTP *http.Client
 }
 
-func (cl ClientImpl) doGet(uri string, qp url.Values, body provider.CacheEntry) error {
-	cache := cl.Cache.Get("TMDB_ENTITIES", 24*time.Hour)
+// HTTPOptions configures resilience of the requests to the TMDB API.
+// The rate limit follows the published one of 40 requests per 10 seconds.
+var HTTPOptions = httpu.TransportOptions{
+	Name:             "tmdb",
+	Timeout:          10 * time.Second,
+	MaxRetries:       3,
+	MinBackoff:       250 * time.Millisecond,
+	MaxBackoff:       5 * time.Second,
+	MaxRetryAfter:    15 * time.Second,
+	RateLimit:        4,
+	Burst:            40,
+	BreakerThreshold: 5,
+	BreakerCooldown:  30 * time.Second,
+}
 
-	if cache.Load(uri, body) {
-		return nil
-	}
+var defaultHTTPClient = httpu.NewClient(HTTPOptions)
 
-	if qp == nil {
-		qp = url.Values{}
-	}
+// Media types of the TMDB entries
+const (
+	MediaTypeTV    = "tv"
+	MediaTypeMovie = "movie"
+)
 
-	qp.Add("api_key", cl.APIKey)
+// SearchPageSize is the number of results on a page of the search
+const SearchPageSize = 20
 
-	resp, err := goreq.Request{
-		Method:      "GET",
-		Uri:         uri,
-		QueryString: qp,
-	}.Do()
+const (
+	// EntitiesCache holds all the TMDB responses unless a more specific cache is used
+	EntitiesCache = "TMDB_ENTITIES"
+	// AiringSeasonsCache holds seasons of the shows that are still on air
+	AiringSeasonsCache = "TMDB_AIRING_SEASONS"
+	// NotFoundCache holds external ids that have no matching TMDB entry
+	NotFoundCache = "TMDB_NOT_FOUND"
+	// SearchCache holds results of the searches by query
+	SearchCache = "TMDB_SEARCH"
+)
+
+// errNotFound tells that the search has no results, so there is nothing to cache
+var errNotFound = errors.New("entry not found")
+
+func (cl ClientImpl) doGet(ctx context.Context, uri string, qp url.Values, body provider.CacheEntry) error {
+	return cl.doCachedGet(ctx, cl.Cache.Get(EntitiesCache, 24*time.Hour), uri, qp, body)
+}
+
+func (cl ClientImpl) doCachedGet(ctx context.Context, cache provider.Cache, uri string, qp url.Values, body provider.CacheEntry) error {
+	return provider.Fetch(ctx, cache, uri, body, func(ctx context.Context) (provider.CacheEntry, error) {
+		return cl.request(ctx, uri, qp)
+	})
+}
 
-	if resp == nil {
-		return errors.New("Network error: response is null")
+// request fetches raw response from the TMDB API
+func (cl ClientImpl) request(ctx context.Context, uri string, qp url.Values) (*provider.RawEntry, error) {
+	params := url.Values{}
+	for k, v := range qp {
+		params[k] = v
 	}
+	params.Add("api_key", cl.APIKey)
 
-	if resp.StatusCode != http.StatusOK {
-		return errors.Errorf("Network error - %s", resp.Status)
+	req, err := httpu.NewRequest(ctx, "GET", uri, params, nil)
+	if err != nil {
+		return nil, err
 	}
 
-	rb, err := resp.Body.ToString()
+	client := cl.HTTP
+	if client == nil {
+		client = defaultHTTPClient
+	}
+
+	resp, err := client.Do(req)
 	if err != nil {
-		return errors.WithMessage(err, "cannot read response body")
+		return nil, errors.WithMessage(err, "Network error")
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("Network error - %s", resp.Status)
 	}
 
-	err = body.UnmarshalBinary([]byte(rb))
+	rb, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
-		return errors.WithMessage(err, "cannot unmarshal response")
+		return nil, errors.WithMessage(err, "cannot read response body")
 	}
 
-	cache.Save(uri, body)
+	if !json.Valid(rb) {
+		return nil, errors.New("cannot unmarshal response")
+	}
 
-	return nil
+	data := provider.RawEntry(rb)
+	return &data, nil
 }
 
 // GetTVShowByID returns the primary TV show details by id.
-func (cl ClientImpl) GetTVShowByID(id int) (*TVShow, error) {
+func (cl ClientImpl) GetTVShowByID(ctx context.Context, id int) (*TVShow, error) {
 	cl.Logger.Debugf("Getting TMDB show by ID=[%d]", id)
 
 	show := &TVShow{}
-	err := cl.doGet(httpu.JoinURL(BaseURL, "tv", strconv.Itoa(id)), nil, provider.Cacheable(show))
+	err := cl.doGet(ctx, httpu.JoinURL(BaseURL, "tv", strconv.Itoa(id)), nil, provider.Cacheable(show))
 	if err != nil {
 		return nil, err
 	}
@@ -115,9 +178,9 @@ func (cl ClientImpl) GetTVShowByID(id int) (*TVShow, error) {
 }
 
 // GetTVShowExternalIDS returns the external ids for a TV show
-func (cl ClientImpl) GetTVShowExternalIDS(id int) (*Ids, error) {
+func (cl ClientImpl) GetTVShowExternalIDS(ctx context.Context, id int) (*Ids, error) {
 	ids := &Ids{}
-	err := cl.doGet(httpu.JoinURL(BaseURL, "tv", id, "external_ids"), nil, provider.Cacheable(ids))
+	err := cl.doGet(ctx, httpu.JoinURL(BaseURL, "tv", id, "external_ids"), nil, provider.Cacheable(ids))
 	if err != nil {
 		return nil, err
 	}
@@ -126,9 +189,9 @@ func (cl ClientImpl) GetTVShowExternalIDS(id int) (*Ids, error) {
 }
 
 // GetTVShowImages returns the images that belong to a TV show.
-func (cl ClientImpl) GetTVShowImages(id int) (*ShowBackdrops, error) {
+func (cl ClientImpl) GetTVShowImages(ctx context.Context, id int) (*ShowBackdrops, error) {
 	backdrops := &ShowBackdrops{}
-	err := cl.doGet(httpu.JoinURL(BaseURL, "tv", id, "images"), nil, provider.Cacheable(backdrops))
+	err := cl.doGet(ctx, httpu.JoinURL(BaseURL, "tv", id, "images"), nil, provider.Cacheable(backdrops))
 	if err != nil {
 		return nil, err
 	}
@@ -136,10 +199,20 @@ func (cl ClientImpl) GetTVShowImages(id int) (*ShowBackdrops, error) {
 	return backdrops, nil
 }
 
-// GetTVSeason return the detailed information about the season
-func (cl ClientImpl) GetTVSeason(seriesID, seasonNum int) (*TVSeason, error) {
+// GetTVSeason return the detailed information about the season.
+// Seasons of the shows that are still on air expire sooner, as new episodes keep appearing.
+func (cl ClientImpl) GetTVSeason(ctx context.Context, seriesID, seasonNum int) (*TVSeason, error) {
+	cache := cl.Cache.Get(EntitiesCache, 24*time.Hour)
+
+	show, err := cl.GetTVShowByID(ctx, seriesID)
+	if err != nil {
+		cl.Logger.Warnf("Cannot check status of the show [%d]: %s", seriesID, err.Error())
+	} else if show.Airing() {
+		cache = cl.Cache.Get(AiringSeasonsCache, 6*time.Hour)
+	}
+
 	season := &TVSeason{}
-	err := cl.doGet(httpu.JoinURL(BaseURL, "tv", seriesID, "season", seasonNum), nil, provider.Cacheable(season))
+	err = cl.doCachedGet(ctx, cache, httpu.JoinURL(BaseURL, "tv", seriesID, "season", seasonNum), nil, provider.Cacheable(season))
 	if err != nil {
 		cl.Logger.Error(err)
 		return nil, errors.Wrap(err, "Unable to get season")
@@ -151,11 +224,11 @@ func (cl ClientImpl) GetTVSeason(seriesID, seasonNum int) (*TVSeason, error) {
 }
 
 // GetTVEpisode returns TV episode details by id.
-func (cl ClientImpl) GetTVEpisode(tvID int, seasonNum int, episodeNum int) (*TVEpisode, error) {
+func (cl ClientImpl) GetTVEpisode(ctx context.Context, tvID int, seasonNum int, episodeNum int) (*TVEpisode, error) {
 	url := httpu.JoinURL(BaseURL, "tv", tvID, "season", seasonNum, "episode", episodeNum)
 
 	episode := &TVEpisode{}
-	err := cl.doGet(url, nil, provider.Cacheable(episode))
+	err := cl.doGet(ctx, url, nil, provider.Cacheable(episode))
 
 	if err != nil {
 		return nil, err
@@ -165,11 +238,11 @@ func (cl ClientImpl) GetTVEpisode(tvID int, seasonNum int, episodeNum int) (*TVE
 }
 
 // GetTVEpisodeImages returnes the images that belong to a TV episode.
-func (cl ClientImpl) GetTVEpisodeImages(tvID int, seasonNum int, episodeNum int) (TVEpisodeStills, error) {
+func (cl ClientImpl) GetTVEpisodeImages(ctx context.Context, tvID int, seasonNum int, episodeNum int) (TVEpisodeStills, error) {
 	url := httpu.JoinURL(BaseURL, "tv", tvID, "season", seasonNum, "episode", episodeNum, "images")
 
 	stills := TVEpisodeStills{}
-	err := cl.doGet(url, nil, provider.Cacheable(&stills))
+	err := cl.doGet(ctx, url, nil, provider.Cacheable(&stills))
 
 	if err != nil {
 		return stills, err
@@ -178,16 +251,43 @@ func (cl ClientImpl) GetTVEpisodeImages(tvID int, seasonNum int, episodeNum int)
 	return stills, nil
 }
 
-// FindByExternalID search TMDB entry by IMDB id
-func (cl ClientImpl) FindByExternalID(id string) (*SearchResult, error) {
+// FindByExternalID search TMDB entry by IMDB id. Empty results are cached for a shorter time.
+func (cl ClientImpl) FindByExternalID(ctx context.Context, id string) (*SearchResult, error) {
 	uri := httpu.JoinURL(BaseURL, "find", id)
 	result := &SearchResult{}
 
-	err := cl.doGet(
-		uri,
-		map[string][]string{"external_source": []string{"imdb_id"}},
-		provider.Cacheable(result),
-	)
+	notFound := cl.Cache.Get(NotFoundCache, 6*time.Hour)
+	if provider.IsMarkedNotFound(notFound, uri) {
+		cl.Logger.Debugf("Nothing has been found by external id [%s] recently", id)
+		return result, nil
+	}
+
+	cache := cl.Cache.Get(EntitiesCache, 24*time.Hour)
+	err := provider.Fetch(ctx, cache, uri, result, func(ctx context.Context) (provider.CacheEntry, error) {
+		data, err := cl.request(ctx, uri, map[string][]string{"external_source": []string{"imdb_id"}})
+		if err != nil {
+			return nil, err
+		}
+
+		found := SearchResult{}
+		if err = found.UnmarshalBinary(*data); err != nil {
+			return nil, err
+		}
+
+		if found.Empty() {
+			return nil, errNotFound
+		}
+
+		return data, nil
+	})
+
+	if err == errNotFound {
+		if err = provider.MarkNotFound(notFound, uri); err != nil {
+			cl.Logger.Errorf("Cannot cache missing external id [%s]: %s", id, err.Error())
+		}
+		return result, nil
+	}
+
 	if err != nil {
 		return nil, err
 	}
@@ -196,8 +296,8 @@ func (cl ClientImpl) FindByExternalID(id string) (*SearchResult, error) {
 	return result, nil
 }
 
-func (cl ClientImpl) FindTVShowByExternalID(id string) (*TVShow, error) {
-	result, err := cl.FindByExternalID(id)
+func (cl ClientImpl) FindTVShowByExternalID(ctx context.Context, id string) (*TVShow, error) {
+	result, err := cl.FindByExternalID(ctx, id)
 	if err != nil {
 		return nil, err
 	}
@@ -209,8 +309,8 @@ func (cl ClientImpl) FindTVShowByExternalID(id string) (*TVShow, error) {
 	return nil, nil
 }
 
-func (cl ClientImpl) FindMovieByExternalID(id string) (*Movie, error) {
-	result, err := cl.FindByExternalID(id)
+func (cl ClientImpl) FindMovieByExternalID(ctx context.Context, id string) (*Movie, error) {
+	result, err := cl.FindByExternalID(ctx, id)
 	if err != nil {
 		return nil, err
 	}
@@ -222,11 +322,11 @@ func (cl ClientImpl) FindMovieByExternalID(id string) (*Movie, error) {
 	return nil, nil
 }
 
-func (cl ClientImpl) Movie(id int) (*Movie, error) {
+func (cl ClientImpl) Movie(ctx context.Context, id int) (*Movie, error) {
 	url := httpu.JoinURL(BaseURL, "movie", id)
 
 	movie := &Movie{}
-	err := cl.doGet(url, nil, provider.Cacheable(movie))
+	err := cl.doGet(ctx, url, nil, provider.Cacheable(movie))
 
 	if err != nil {
 		return nil, err
@@ -235,6 +335,54 @@ func (cl ClientImpl) Movie(id int) (*Movie, error) {
 	return movie, nil
 }
 
+// GetAlternativeTitles returns the titles the TV show ("tv") or movie ("movie") is known by in the other countries.
+func (cl ClientImpl) GetAlternativeTitles(ctx context.Context, mediaType string, id int) (*AlternativeTitles, error) {
+	if mediaType != MediaTypeTV && mediaType != MediaTypeMovie {
+		return nil, errors.Errorf("Unknown media type [%s]", mediaType)
+	}
+
+	titles := &AlternativeTitles{}
+	err := cl.doGet(ctx, httpu.JoinURL(BaseURL, mediaType, id, "alternative_titles"), nil, provider.Cacheable(titles))
+	if err != nil {
+		return nil, err
+	}
+
+	return titles, nil
+}
+
+// SearchMulti searches for TV shows, movies and people. Page is 1-based, zero means the first one.
+func (cl ClientImpl) SearchMulti(ctx context.Context, query string, page int) (*MultiSearchResults, error) {
+	uri := httpu.JoinURL(BaseURL, "search", "multi")
+
+	qp := url.Values{"query": {query}}
+	if page > 0 {
+		qp.Set("page", strconv.Itoa(page))
+	}
+
+	results := &MultiSearchResults{}
+	// the query is a part of the key, as the same endpoint serves all the searches
+	err := provider.Fetch(ctx, cl.Cache.Get(SearchCache, time.Hour), uri+"?"+qp.Encode(), provider.Cacheable(results), func(ctx context.Context) (provider.CacheEntry, error) {
+		return cl.request(ctx, uri, qp)
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return results, nil
+}
+
+// ForgetExternalID drops cached result of the search by external id
+func (cl ClientImpl) ForgetExternalID(id string) error {
+	uri := httpu.JoinURL(BaseURL, "find", id)
+
+	if err := provider.Forget(cl.Cache, EntitiesCache, uri); err != nil {
+		return err
+	}
+
+	return provider.Forget(cl.Cache, NotFoundCache, uri)
+}
+
 // OriginalSize is a parameter to ImagePath to get url to image in original size
 const OriginalSize = -1
 
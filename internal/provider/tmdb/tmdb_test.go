@@ -1,6 +1,7 @@
 package tmdb
 
 import (
+	"fmt"
 	"testing"
 )
 
@@ -53,3 +54,20 @@ func TestImagePath(t *testing.T) {
 		})
 	}
 }
+
+func TestAlternativeTitles_ByCountry(t *testing.T) {
+	titles := AlternativeTitles{
+		Results: []AlternativeTitle{
+			{Country: "US", Title: "Daredevil"},
+			{Country: "RU", Title: "Сорвиголова"},
+			{Country: "UA", Title: "Сорвиголова"},
+			{Country: "RU", Title: "Сорвиголова Marvel"},
+		},
+	}
+
+	got := fmt.Sprint(titles.ByCountry("RU"))
+	want := fmt.Sprint([]string{"Сорвиголова", "Сорвиголова Marvel", "Daredevil"})
+	if got != want {
+		t.Errorf("ByCountry() = %s, want %s", got, want)
+	}
+}
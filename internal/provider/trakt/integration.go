@@ -1,7 +1,6 @@
 package trakt
 
 import (
-	"context"
 	"net/http"
 
 	httpu "github.com/dpfg/kinohub-core/pkg/http"
@@ -19,7 +18,7 @@ func (trakt *Integration) Handler() http.Handler {
 	router := chi.NewRouter()
 
 	router.Get("/trending", func(w http.ResponseWriter, req *http.Request) {
-		shows, err := trakt.Client.TrendingShows()
+		shows, err := trakt.Client.TrendingShows(req.Context())
 		if err != nil {
 			httpu.InternalError(w, req, err)
 			return
@@ -33,7 +32,7 @@ func (trakt *Integration) Handler() http.Handler {
 	})
 
 	router.Get("/exchange", func(w http.ResponseWriter, req *http.Request) {
-		_, err := trakt.Client.Exchange(context.Background(), req.URL.Query().Get("code"))
+		_, err := trakt.Client.Exchange(req.Context(), req.URL.Query().Get("code"))
 		if err != nil {
 			httpu.InternalError(w, req, err)
 			return
@@ -43,7 +42,7 @@ func (trakt *Integration) Handler() http.Handler {
 	})
 
 	router.Get("/status", func(w http.ResponseWriter, req *http.Request) {
-		s, err := trakt.Client.Settings()
+		s, err := trakt.Client.Settings(req.Context())
 		if err != nil {
 			httpu.InternalError(w, req, err)
 			return
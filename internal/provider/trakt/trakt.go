@@ -22,19 +22,45 @@ import (
 type Client struct {
 	Config            oauth2.Config
 	PreferenceStorage provider.PreferenceStorage
-	Logger            *logrus.Entry
+	// HTTP, if set, replaces the client configured by HTTPOptions
+	HTTP   *http.Client
+	Logger *logrus.Entry
 }
 
 const (
 	BaseURL = "https://api.trakt.tv"
 )
 
+// HTTPOptions configures resilience of the requests to the Trakt API
+var HTTPOptions = httpu.TransportOptions{
+	Name:             "trakt",
+	Timeout:          15 * time.Second,
+	MaxRetries:       2,
+	MinBackoff:       500 * time.Millisecond,
+	MaxBackoff:       5 * time.Second,
+	MaxRetryAfter:    15 * time.Second,
+	BreakerThreshold: 5,
+	BreakerCooldown:  30 * time.Second,
+}
+
+var defaultHTTPClient = httpu.NewClient(HTTPOptions)
+
+// withHTTPClient returns context that makes oauth2 send requests through the resilient transport
+func (tc *Client) withHTTPClient(ctx context.Context) context.Context {
+	client := tc.HTTP
+	if client == nil {
+		client = defaultHTTPClient
+	}
+
+	return context.WithValue(ctx, oauth2.HTTPClient, client)
+}
+
 func (tc *Client) AuthCodeURL() string {
 	return tc.Config.AuthCodeURL("")
 }
 
 func (tc *Client) Exchange(ctx context.Context, code string) (*oauth2.Token, error) {
-	token, err := tc.Config.Exchange(ctx, code)
+	token, err := tc.Config.Exchange(tc.withHTTPClient(ctx), code)
 	if err != nil {
 		return nil, errors.Wrap(err, "Unable to exchange code to token")
 	}
@@ -47,15 +73,16 @@ func (tc *Client) Exchange(ctx context.Context, code string) (*oauth2.Token, err
 	return token, nil
 }
 
-func (tc *Client) get(url string, m interface{}) error {
+func (tc *Client) get(ctx context.Context, url string, m interface{}) error {
 	t := &oauth2.Token{}
 	err := tc.PreferenceStorage.Load("trakt", t)
 	if err != nil {
 		return errors.Wrap(err, "Unable ot load preferences")
 	}
 
-	cl := tc.Config.Client(context.TODO(), t)
+	cl := tc.Config.Client(tc.withHTTPClient(ctx), t)
 	req, _ := http.NewRequest("GET", url, nil)
+	req = req.WithContext(ctx)
 
 	req.Header.Add("trakt-api-version", "2")
 	req.Header.Add("trakt-api-key", tc.Config.ClientID)
@@ -84,7 +111,7 @@ func (tc *Client) get(url string, m interface{}) error {
 	return nil
 }
 
-func (tc *Client) post(url string, body interface{}, response interface{}) error {
+func (tc *Client) post(ctx context.Context, url string, body interface{}, response interface{}) error {
 	tc.Logger.Debugf("POST to URL: %s", url)
 
 	t := &oauth2.Token{}
@@ -93,7 +120,7 @@ func (tc *Client) post(url string, body interface{}, response interface{}) error
 		return err
 	}
 
-	cl := tc.Config.Client(context.TODO(), t)
+	cl := tc.Config.Client(tc.withHTTPClient(ctx), t)
 
 	bodyBytes, err := json.Marshal(body)
 	if err != nil {
@@ -103,6 +130,7 @@ func (tc *Client) post(url string, body interface{}, response interface{}) error
 	tc.Logger.Debugf("%s", bodyBytes)
 
 	req, _ := http.NewRequest("POST", url, bytes.NewBuffer(bodyBytes))
+	req = req.WithContext(ctx)
 
 	req.Header.Add("trakt-api-version", "2")
 	req.Header.Add("trakt-api-key", tc.Config.ClientID)
@@ -137,9 +165,9 @@ func (tc *Client) post(url string, body interface{}, response interface{}) error
 	return nil
 }
 
-func (tc *Client) TrendingShows() ([]interface{}, error) {
+func (tc *Client) TrendingShows(ctx context.Context) ([]interface{}, error) {
 	m := make([]interface{}, 0)
-	err := tc.get(httpu.JoinURL(BaseURL, "shows", "trending"), &m)
+	err := tc.get(ctx, httpu.JoinURL(BaseURL, "shows", "trending"), &m)
 	if err != nil {
 		return nil, err
 	}
@@ -148,16 +176,16 @@ func (tc *Client) TrendingShows() ([]interface{}, error) {
 }
 
 // Settings - https://trakt.docs.apiary.io/#reference/users/settings/retrieve-settings
-func (tc *Client) Settings() (interface{}, error) {
+func (tc *Client) Settings(ctx context.Context) (interface{}, error) {
 	m := make([]interface{}, 0)
-	err := tc.get(httpu.JoinURL(BaseURL, "users", "settings", "retrieve-settings"), &m)
+	err := tc.get(ctx, httpu.JoinURL(BaseURL, "users", "settings", "retrieve-settings"), &m)
 	if err != nil {
 		return nil, err
 	}
 	return m, nil
 }
 
-func (tc *Client) MyShows(from time.Time, to time.Time) ([]MyShow, error) {
+func (tc *Client) MyShows(ctx context.Context, from time.Time, to time.Time) ([]MyShow, error) {
 	tc.Logger.Debugf("Loading My Shows: %v, %v", from, to)
 
 	m := make([]MyShow, 0)
@@ -165,7 +193,7 @@ func (tc *Client) MyShows(from time.Time, to time.Time) ([]MyShow, error) {
 	fromDate := from.Format("2006-01-02")
 	numDays := int(to.Sub(from).Hours() / 24)
 
-	err := tc.get(httpu.JoinURL(BaseURL, "calendars", "my", "shows", fromDate, strconv.Itoa(numDays)), &m)
+	err := tc.get(ctx, httpu.JoinURL(BaseURL, "calendars", "my", "shows", fromDate, strconv.Itoa(numDays)), &m)
 	if err != nil {
 		tc.Logger.Error(err.Error())
 		return nil, errors.WithStack(err)
@@ -175,7 +203,7 @@ func (tc *Client) MyShows(from time.Time, to time.Time) ([]MyShow, error) {
 }
 
 // Scrobble starts scrobbling new item.
-func (tc *Client) Scrobble(tmdbID int) error {
+func (tc *Client) Scrobble(ctx context.Context, tmdbID int) error {
 	tc.Logger.Debugf("Scrobbling %d", tmdbID)
 
 	body := struct {
@@ -190,7 +218,7 @@ func (tc *Client) Scrobble(tmdbID int) error {
 		Progress: 0,
 	}
 
-	return tc.post(httpu.JoinURL(BaseURL, "scrobble", "start"), body, nil)
+	return tc.post(ctx, httpu.JoinURL(BaseURL, "scrobble", "start"), body, nil)
 }
 
 // NewTraktClient creates new client
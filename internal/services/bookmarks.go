@@ -0,0 +1,142 @@
+package services
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+
+	"github.com/dpfg/kinohub-core/domain"
+	"github.com/dpfg/kinohub-core/internal/provider/kinopub"
+	httpu "github.com/dpfg/kinohub-core/pkg/http"
+	"github.com/go-chi/chi"
+	"github.com/go-chi/render"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// Bookmarks exposes bookmark folders of the kinopub account
+type Bookmarks struct {
+	Logger  *logrus.Entry
+	Kinopub kinopub.KinoPubClient
+}
+
+// Handler returns http.Handler that serves bookmark-related requests
+func (bm Bookmarks) Handler() http.Handler {
+	router := chi.NewRouter()
+
+	router.Get("/", func(w http.ResponseWriter, req *http.Request) {
+		folders, err := bm.Folders(req.Context())
+		if err != nil {
+			httpu.BadGateway(w, req, err)
+			return
+		}
+
+		render.JSON(w, req, folders)
+	})
+
+	router.Post("/", func(w http.ResponseWriter, req *http.Request) {
+		body := struct {
+			Title string `json:"title"`
+		}{}
+
+		if err := render.DecodeJSON(req.Body, &body); err != nil {
+			httpu.BadRequest(w, req, err)
+			return
+		}
+
+		if body.Title == "" {
+			httpu.BadRequest(w, req, errors.New("Folder title is required"))
+			return
+		}
+
+		folder, err := bm.Kinopub.CreateBookmarkFolder(req.Context(), body.Title)
+		if err != nil {
+			httpu.BadGateway(w, req, err)
+			return
+		}
+
+		render.Status(req, http.StatusCreated)
+		render.JSON(w, req, folder.ToDomain())
+	})
+
+	router.Get("/{folder-id}", func(w http.ResponseWriter, req *http.Request) {
+		folderID, err := strconv.Atoi(chi.URLParam(req, "folder-id"))
+		if err != nil {
+			httpu.BadRequest(w, req, err)
+			return
+		}
+
+		page, err := pageParam(req)
+		if err != nil {
+			httpu.BadRequest(w, req, err)
+			return
+		}
+
+		items, err := bm.Kinopub.GetBookmarkItems(req.Context(), folderID, page)
+		if err != nil {
+			httpu.BadGateway(w, req, err)
+			return
+		}
+
+		render.JSON(w, req, toSearchResults(items))
+	})
+
+	router.Delete("/{folder-id}", func(w http.ResponseWriter, req *http.Request) {
+		folderID, err := strconv.Atoi(chi.URLParam(req, "folder-id"))
+		if err != nil {
+			httpu.BadRequest(w, req, err)
+			return
+		}
+
+		if err = bm.Kinopub.RemoveBookmarkFolder(req.Context(), folderID); err != nil {
+			httpu.BadGateway(w, req, err)
+			return
+		}
+
+		render.NoContent(w, req)
+	})
+
+	router.Put("/{folder-id}/items/{uid}", bm.itemHandler(bm.Kinopub.AddBookmark))
+	router.Delete("/{folder-id}/items/{uid}", bm.itemHandler(bm.Kinopub.RemoveBookmark))
+
+	return router
+}
+
+// Folders returns all bookmark folders
+func (bm Bookmarks) Folders(ctx context.Context) ([]domain.BookmarkFolder, error) {
+	folders, err := bm.Kinopub.GetBookmarkFolders(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	r := make([]domain.BookmarkFolder, 0, len(folders))
+	for _, f := range folders {
+		r = append(r, f.ToDomain())
+	}
+
+	return r, nil
+}
+
+// itemHandler handles requests to add or remove bookmarked item
+func (bm Bookmarks) itemHandler(action func(ctx context.Context, folderID int, itemID int) error) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		folderID, err := strconv.Atoi(chi.URLParam(req, "folder-id"))
+		if err != nil {
+			httpu.BadRequest(w, req, err)
+			return
+		}
+
+		itemID, err := kinopub.ParseUID(chi.URLParam(req, "uid"))
+		if err != nil {
+			httpu.BadRequest(w, req, err)
+			return
+		}
+
+		if err = action(req.Context(), folderID, itemID); err != nil {
+			httpu.BadGateway(w, req, err)
+			return
+		}
+
+		render.NoContent(w, req)
+	}
+}
@@ -0,0 +1,102 @@
+package services
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/dpfg/kinohub-core/internal/provider/kinopub"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// bookmarksKinopub records the last bookmarks call and fails all of them if asked to
+type bookmarksKinopub struct {
+	kinopub.KinoPubClient
+	call string
+	err  error
+}
+
+func (c *bookmarksKinopub) record(call string) error {
+	c.call = call
+	return c.err
+}
+
+func (c *bookmarksKinopub) GetBookmarkFolders(ctx context.Context) ([]kinopub.BookmarkFolder, error) {
+	return []kinopub.BookmarkFolder{{ID: 1, Title: "Family"}}, c.record("folders")
+}
+
+func (c *bookmarksKinopub) GetBookmarkItems(ctx context.Context, folderID int, page int) (*kinopub.ItemsPage, error) {
+	if err := c.record("items"); err != nil {
+		return nil, err
+	}
+	return &kinopub.ItemsPage{Items: []kinopub.Item{{ID: 8930}}}, nil
+}
+
+func (c *bookmarksKinopub) CreateBookmarkFolder(ctx context.Context, title string) (*kinopub.BookmarkFolder, error) {
+	if err := c.record("create " + title); err != nil {
+		return nil, err
+	}
+	return &kinopub.BookmarkFolder{ID: 2, Title: title}, nil
+}
+
+func (c *bookmarksKinopub) RemoveBookmarkFolder(ctx context.Context, folderID int) error {
+	return c.record("remove folder")
+}
+
+func (c *bookmarksKinopub) AddBookmark(ctx context.Context, folderID int, itemID int) error {
+	return c.record("add item")
+}
+
+func (c *bookmarksKinopub) RemoveBookmark(ctx context.Context, folderID int, itemID int) error {
+	return c.record("remove item")
+}
+
+func TestBookmarks_Handler(t *testing.T) {
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		body       string
+		err        error
+		wantStatus int
+		wantCall   string
+		wantBody   string
+	}{
+		{name: "Folders", method: http.MethodGet, path: "/", wantStatus: http.StatusOK, wantCall: "folders", wantBody: `"title":"Family"`},
+		{name: "Folders unavailable", method: http.MethodGet, path: "/", err: errors.New("service is down"), wantStatus: http.StatusBadGateway, wantCall: "folders"},
+		{name: "Create folder", method: http.MethodPost, path: "/", body: `{"title": "Kids"}`, wantStatus: http.StatusCreated, wantCall: "create Kids", wantBody: `"title":"Kids"`},
+		{name: "Create folder without title", method: http.MethodPost, path: "/", body: `{}`, wantStatus: http.StatusBadRequest},
+		{name: "Create folder with invalid body", method: http.MethodPost, path: "/", body: `{`, wantStatus: http.StatusBadRequest},
+		{name: "Folder items", method: http.MethodGet, path: "/1?page=2", wantStatus: http.StatusOK, wantCall: "items", wantBody: `"KH8930"`},
+		{name: "Invalid folder id", method: http.MethodGet, path: "/family", wantStatus: http.StatusBadRequest},
+		{name: "Remove folder", method: http.MethodDelete, path: "/1", wantStatus: http.StatusNoContent, wantCall: "remove folder"},
+		{name: "Add item", method: http.MethodPut, path: "/1/items/KH8930", wantStatus: http.StatusNoContent, wantCall: "add item"},
+		{name: "Add item with TMDB uid", method: http.MethodPut, path: "/1/items/TM1399", wantStatus: http.StatusBadRequest},
+		{name: "Add item unavailable", method: http.MethodPut, path: "/1/items/KH8930", err: errors.New("service is down"), wantStatus: http.StatusBadGateway, wantCall: "add item"},
+		{name: "Remove item", method: http.MethodDelete, path: "/1/items/KH8930", wantStatus: http.StatusNoContent, wantCall: "remove item"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			kpc := &bookmarksKinopub{err: tt.err}
+			bm := Bookmarks{Logger: logrus.NewEntry(logrus.StandardLogger()), Kinopub: kpc}
+
+			rec := httptest.NewRecorder()
+			bm.Handler().ServeHTTP(rec, httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body)))
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("%s %s = %d, want %d (%s)", tt.method, tt.path, rec.Code, tt.wantStatus, rec.Body.String())
+			}
+
+			if kpc.call != tt.wantCall {
+				t.Errorf("%s %s called %q, want %q", tt.method, tt.path, kpc.call, tt.wantCall)
+			}
+
+			if !strings.Contains(rec.Body.String(), tt.wantBody) {
+				t.Errorf("%s %s body = %s, want it to contain %s", tt.method, tt.path, rec.Body.String(), tt.wantBody)
+			}
+		})
+	}
+}
@@ -0,0 +1,147 @@
+package services
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/dpfg/kinohub-core/domain"
+	"github.com/dpfg/kinohub-core/internal/provider/kinopub"
+	httpu "github.com/dpfg/kinohub-core/pkg/http"
+	"github.com/go-chi/chi"
+	"github.com/go-chi/render"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// Discover provides the feeds of the titles available to play
+type Discover struct {
+	Logger  *logrus.Entry
+	Kinopub kinopub.KinoPubClient
+}
+
+// Handler returns http.Handler that serves discovery requests
+func (d Discover) Handler() http.Handler {
+	router := chi.NewRouter()
+
+	router.Get("/kinopub/collections", func(w http.ResponseWriter, req *http.Request) {
+		page, err := pageParam(req)
+		if err != nil {
+			httpu.BadRequest(w, req, err)
+			return
+		}
+
+		collections, err := d.Collections(req.Context(), page)
+		if err != nil {
+			httpu.BadGateway(w, req, err)
+			return
+		}
+
+		render.JSON(w, req, collections)
+	})
+
+	router.Get("/kinopub/collections/{collection-id}", func(w http.ResponseWriter, req *http.Request) {
+		id, err := strconv.Atoi(chi.URLParam(req, "collection-id"))
+		if err != nil {
+			httpu.BadRequest(w, req, err)
+			return
+		}
+
+		collection, err := d.Collection(req.Context(), id)
+		if err != nil {
+			httpu.BadGateway(w, req, err)
+			return
+		}
+
+		render.JSON(w, req, collection)
+	})
+
+	// fresh, hot or popular items filtered by type, page and per_page query parameters
+	router.Get("/kinopub/{feed}", func(w http.ResponseWriter, req *http.Request) {
+		feed := chi.URLParam(req, "feed")
+		switch feed {
+		case kinopub.FeedFresh, kinopub.FeedHot, kinopub.FeedPopular:
+		default:
+			httpu.NotFound(w, req, errors.Errorf("Unknown feed [%s]", feed))
+			return
+		}
+
+		filter, err := parseDiscoverFilter(req.URL.Query())
+		if err != nil {
+			httpu.BadRequest(w, req, err)
+			return
+		}
+
+		page, err := d.Kinopub.DiscoverItems(req.Context(), feed, filter)
+		if err != nil {
+			httpu.BadGateway(w, req, err)
+			return
+		}
+
+		render.JSON(w, req, toSearchResults(page))
+	})
+
+	return router
+}
+
+// Collections returns a page of kinopub editorial collections
+func (d Discover) Collections(ctx context.Context, page int) (*domain.Collections, error) {
+	cp, err := d.Kinopub.GetCollections(ctx, page)
+	if err != nil {
+		return nil, err
+	}
+
+	items := make([]domain.Collection, 0, len(cp.Items))
+	for _, c := range cp.Items {
+		items = append(items, c.ToDomain())
+	}
+
+	return &domain.Collections{
+		Items:      items,
+		Pagination: toDomainPagination(cp.Pagination),
+	}, nil
+}
+
+// Collection returns kinopub editorial collection with its items
+func (d Discover) Collection(ctx context.Context, id int) (*domain.Collection, error) {
+	cv, err := d.Kinopub.GetCollection(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	c := cv.Collection.ToDomain()
+	c.Items = toSearchResultList(cv.Items)
+
+	return &c, nil
+}
+
+// discoverParams are the query parameters the discovery feeds can be filtered by
+var discoverParams = map[string]bool{"type": true, "page": true, "per_page": true}
+
+// parseDiscoverFilter reads filter of the discovery feed. Catalogue filters kinopub
+// doesn't apply to the feeds are rejected rather than ignored.
+func parseDiscoverFilter(q url.Values) (kinopub.ItemsFilter, error) {
+	for name := range q {
+		if !discoverParams[name] {
+			return kinopub.ItemsFilter{}, errors.Errorf("Discovery feeds can't be filtered by [%s]", name)
+		}
+	}
+
+	filter, err := parseItemsFilter(q)
+	if err != nil {
+		return filter, err
+	}
+
+	return filter, filter.Validate()
+}
+
+// pageParam reads optional page number from the query
+func pageParam(req *http.Request) (int, error) {
+	p := req.URL.Query().Get("page")
+	if p == "" {
+		return 0, nil
+	}
+
+	return strconv.Atoi(p)
+}
@@ -0,0 +1,46 @@
+package services
+
+import (
+	"net/url"
+	"reflect"
+	"testing"
+
+	"github.com/dpfg/kinohub-core/internal/provider/kinopub"
+)
+
+func TestParseDiscoverFilter(t *testing.T) {
+	tests := []struct {
+		name    string
+		query   string
+		want    kinopub.ItemsFilter
+		wantErr bool
+	}{
+		{name: "Empty", query: ""},
+		{
+			name:  "Supported",
+			query: "type=serial&page=2&per_page=10",
+			want:  kinopub.ItemsFilter{Type: kinopub.ItemTypeSerial, Page: 2, PerPage: 10},
+		},
+		{name: "Unknown type", query: "type=anime", wantErr: true},
+		{name: "Genre", query: "type=serial&genre=1", wantErr: true},
+		{name: "Title", query: "q=dark", wantErr: true},
+		{name: "Sort", query: "sort=-rating", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q, err := url.ParseQuery(tt.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := parseDiscoverFilter(q)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseDiscoverFilter() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if err == nil && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseDiscoverFilter() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
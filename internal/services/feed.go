@@ -1,10 +1,9 @@
 package services
 
 import (
+	"context"
 	"net/http"
 	"sort"
-	"strconv"
-	"strings"
 	"time"
 
 	"github.com/go-chi/chi"
@@ -22,7 +21,7 @@ import (
 
 type Feed interface {
 	Handler() func(r chi.Router)
-	Releases(from time.Time, to time.Time) ([]FeedItem, error)
+	Releases(ctx context.Context, from time.Time, to time.Time) ([]FeedItem, error)
 }
 
 type FeedItem struct {
@@ -31,8 +30,13 @@ type FeedItem struct {
 	ContentAvailable bool           `json:"content_available,omitempty"`
 }
 
+// releaseCalendar lists the episodes of the shows the user watches
+type releaseCalendar interface {
+	MyShows(ctx context.Context, from time.Time, to time.Time) ([]trakt.MyShow, error)
+}
+
 type FeedImpl struct {
-	tc      *trakt.Client
+	tc      releaseCalendar
 	kpc     kinopub.KinoPubClient
 	tmdbCli tmdb.Client
 	logger  *logrus.Entry
@@ -46,7 +50,7 @@ func (feed FeedImpl) Handler() func(r chi.Router) {
 			from, _ := time.Parse("2006-01-02", req.URL.Query().Get("from"))
 			to, _ := time.Parse("2006-01-02", req.URL.Query().Get("to"))
 
-			releases, err := feed.Releases(from, to)
+			releases, err := feed.Releases(req.Context(), from, to)
 			if err != nil {
 				httpu.InternalError(w, req, err)
 				return
@@ -57,9 +61,9 @@ func (feed FeedImpl) Handler() func(r chi.Router) {
 	}
 }
 
-func (feed FeedImpl) Releases(from time.Time, to time.Time) ([]FeedItem, error) {
+func (feed FeedImpl) Releases(ctx context.Context, from time.Time, to time.Time) ([]FeedItem, error) {
 
-	m, err := feed.tc.MyShows(from, to)
+	m, err := feed.tc.MyShows(ctx, from, to)
 	if err != nil {
 		return nil, err
 	}
@@ -68,15 +72,22 @@ func (feed FeedImpl) Releases(from time.Time, to time.Time) ([]FeedItem, error)
 
 	r := make([]FeedItem, 0)
 	for _, item := range m {
+		// the client has gone, so there is nobody to build the rest of the feed for
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
 
-		imdbID, _ := strconv.Atoi(strings.TrimLeft(item.Show.Ids.Imdb, "tt"))
-		ep, err := feed.kpc.GetEpisode(imdbID, item.Show.Title, item.Episode.Season, item.Episode.Number)
+		// the release is listed even if it can't be looked up on kinopub
+		var ep *kinopub.Episode
+		q, err := showMatchQuery(ctx, feed.tmdbCli, feed.logger, item.Show.Ids.Tmdb)
 		if err != nil {
+			feed.logger.Errorln(errors.WithMessage(err, "Cannot load TMDB show").Error())
+		} else if ep, err = feed.kpc.GetEpisode(ctx, q, item.Episode.Season, item.Episode.Number); err != nil {
 			feed.logger.Errorln(errors.WithMessage(err, "Cannot load KinHub episode").Error())
-			continue
+			ep = nil
 		}
 
-		images, _ := feed.tmdbCli.GetTVEpisodeImages(item.Show.Ids.Tmdb, item.Episode.Season, item.Episode.Number)
+		images, _ := feed.tmdbCli.GetTVEpisodeImages(ctx, item.Show.Ids.Tmdb, item.Episode.Season, item.Episode.Number)
 		episodeStill := ""
 		if len(images.Stills) > 0 {
 			episodeStill = tmdb.ImagePath(images.Stills[0].FilePath, 300)
@@ -0,0 +1,92 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/dpfg/kinohub-core/internal/provider/kinopub"
+	"github.com/dpfg/kinohub-core/internal/provider/tmdb"
+	"github.com/dpfg/kinohub-core/internal/provider/trakt"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+type testCalendar []trakt.MyShow
+
+func (c testCalendar) MyShows(ctx context.Context, from time.Time, to time.Time) ([]trakt.MyShow, error) {
+	return c, nil
+}
+
+// feedTMDB knows every show but the broken one
+type feedTMDB struct {
+	tmdb.Client
+	broken int
+}
+
+func (c feedTMDB) GetTVShowByID(ctx context.Context, id int) (*tmdb.TVShow, error) {
+	if id == c.broken {
+		return nil, errors.New("TMDB is down")
+	}
+	return &tmdb.TVShow{ID: id, Name: "Show"}, nil
+}
+
+func (c feedTMDB) GetTVShowExternalIDS(ctx context.Context, id int) (*tmdb.Ids, error) {
+	return &tmdb.Ids{}, nil
+}
+
+func (c feedTMDB) GetAlternativeTitles(ctx context.Context, mediaType string, id int) (*tmdb.AlternativeTitles, error) {
+	return nil, nil
+}
+
+func (c feedTMDB) GetTVEpisodeImages(ctx context.Context, tvID int, seasonNum int, episodeNum int) (tmdb.TVEpisodeStills, error) {
+	return tmdb.TVEpisodeStills{}, nil
+}
+
+// feedKinopub has episodes of every show but the broken one
+type feedKinopub struct {
+	kinopub.KinoPubClient
+	broken int
+}
+
+func (c feedKinopub) GetEpisode(ctx context.Context, q kinopub.MatchQuery, seasonNum int, episodeNum int) (*kinopub.Episode, error) {
+	if q.TMDBID == c.broken {
+		return nil, errors.New("kinopub is down")
+	}
+	return &kinopub.Episode{Number: episodeNum}, nil
+}
+
+func TestFeed_Releases(t *testing.T) {
+	now := time.Now()
+	calendar := make(testCalendar, 0)
+	for id := 1; id <= 3; id++ {
+		show := trakt.MyShow{FirstAired: now.Add(-time.Duration(id) * time.Hour), Episode: trakt.Episode{Season: 1, Number: id}}
+		show.Show.Ids.Tmdb = id
+		calendar = append(calendar, show)
+	}
+
+	feed := FeedImpl{
+		tc:      calendar,
+		kpc:     feedKinopub{broken: 2},
+		tmdbCli: feedTMDB{broken: 3},
+		logger:  logrus.NewEntry(logrus.StandardLogger()),
+	}
+
+	got, err := feed.Releases(context.Background(), now.Add(-24*time.Hour), now)
+	if err != nil {
+		t.Fatalf("Releases() error = %v", err)
+	}
+
+	// releases that can't be looked up on kinopub are listed as unavailable
+	want := []bool{true, false, false}
+	if len(got) != len(want) {
+		t.Fatalf("Releases() = %d items, want %d", len(got), len(want))
+	}
+
+	for i, item := range got {
+		if item.Episode.Number != i+1 || item.ContentAvailable != want[i] {
+			t.Errorf("Releases()[%d] = episode %d available %v, want episode %d available %v",
+				i, item.Episode.Number, item.ContentAvailable, i+1, want[i])
+		}
+	}
+}
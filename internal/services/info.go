@@ -1,13 +1,16 @@
 package services
 
 import (
+	"context"
 	"net/http"
 	"strconv"
 
 	"github.com/dpfg/kinohub-core/domain"
+	"github.com/dpfg/kinohub-core/internal/player"
 	provider "github.com/dpfg/kinohub-core/internal/provider"
 	"github.com/dpfg/kinohub-core/internal/provider/kinopub"
 	"github.com/dpfg/kinohub-core/internal/provider/tmdb"
+	"github.com/dpfg/kinohub-core/internal/stream"
 	httpu "github.com/dpfg/kinohub-core/pkg/http"
 	"github.com/go-chi/chi"
 	"github.com/go-chi/render"
@@ -17,9 +20,15 @@ import (
 
 // ContentBrowser provides a way to find available media streams
 type ContentBrowser interface {
-	Show(uid string) (*domain.Series, error)
-	Season(uid string, seasonNum int) (*domain.Season, error)
-	Movie(uid string) (*domain.Movie, error)
+	Show(ctx context.Context, uid string) (*domain.Series, error)
+	Season(ctx context.Context, uid string, seasonNum int) (*domain.Season, error)
+	Episode(ctx context.Context, uid string, seasonNum int, episodeNum int) (*domain.Episode, error)
+	EpisodeStream(ctx context.Context, uid string, seasonNum int, episodeNum int, profile string, playerID string) (*domain.Stream, error)
+
+	MarkSeasonWatched(ctx context.Context, uid string, seasonNum int, watched bool) error
+	MarkEpisodeWatched(ctx context.Context, uid string, seasonNum int, episodeNum int, watched bool) error
+	SaveEpisodePosition(ctx context.Context, uid string, seasonNum int, episodeNum int, position int) error
+	Movie(ctx context.Context, uid string) (*domain.Movie, error)
 
 	Handler() func(r chi.Router)
 }
@@ -28,6 +37,7 @@ type ContentBrowserImpl struct {
 	Logger  *logrus.Entry
 	Kinopub kinopub.KinoPubClient
 	TMDB    tmdb.Client
+	Streams *stream.Profiles
 }
 
 func (browser ContentBrowserImpl) Handler() func(r chi.Router) {
@@ -36,7 +46,7 @@ func (browser ContentBrowserImpl) Handler() func(r chi.Router) {
 
 		router.Get("/api/series/{series-id}", func(w http.ResponseWriter, req *http.Request) {
 			uid := chi.URLParam(req, "series-id")
-			show, err := browser.Show(uid)
+			show, err := browser.Show(req.Context(), uid)
 
 			if err != nil {
 				httpu.BadGateway(w, req, err)
@@ -54,7 +64,7 @@ func (browser ContentBrowserImpl) Handler() func(r chi.Router) {
 				return
 			}
 
-			season, err := browser.Season(uid, seasonNum)
+			season, err := browser.Season(req.Context(), uid, seasonNum)
 			if err != nil {
 				httpu.BadRequest(w, req, err)
 				return
@@ -63,9 +73,128 @@ func (browser ContentBrowserImpl) Handler() func(r chi.Router) {
 			render.JSON(w, req, season)
 		})
 
+		router.Get("/api/series/{series-id}/seasons/{season-num}/episodes/{episode-num}", func(w http.ResponseWriter, req *http.Request) {
+			uid := chi.URLParam(req, "series-id")
+
+			seasonNum, episodeNum, err := episodeParams(req)
+			if err != nil {
+				httpu.BadRequest(w, req, err)
+				return
+			}
+
+			episode, err := browser.Episode(req.Context(), uid, seasonNum, episodeNum)
+			if err != nil {
+				httpu.BadGateway(w, req, err)
+				return
+			}
+
+			if episode == nil {
+				httpu.NotFound(w, req, errors.Errorf("Episode S%02dE%02d is not found", seasonNum, episodeNum))
+				return
+			}
+
+			render.JSON(w, req, episode)
+		})
+
+		// the best stream for the profile requested explicitly or assigned to the player
+		router.Get("/api/series/{series-id}/seasons/{season-num}/episodes/{episode-num}/stream", func(w http.ResponseWriter, req *http.Request) {
+			uid := chi.URLParam(req, "series-id")
+
+			seasonNum, episodeNum, err := episodeParams(req)
+			if err != nil {
+				httpu.BadRequest(w, req, err)
+				return
+			}
+
+			playerID := req.URL.Query().Get("player")
+			if cookie, err := req.Cookie(player.UIDCookieName); playerID == "" && err == nil {
+				playerID = cookie.Value
+			}
+
+			st, err := browser.EpisodeStream(req.Context(), uid, seasonNum, episodeNum, req.URL.Query().Get("profile"), playerID)
+			switch {
+			case errors.Cause(err) == stream.ErrUnknownProfile:
+				httpu.BadRequest(w, req, err)
+			case err == stream.ErrNoStream:
+				httpu.NotFound(w, req, err)
+			case err != nil:
+				httpu.BadGateway(w, req, err)
+			case st == nil:
+				httpu.NotFound(w, req, errors.Errorf("Episode S%02dE%02d is not found", seasonNum, episodeNum))
+			default:
+				render.JSON(w, req, st)
+			}
+		})
+
+		markSeason := func(watched bool) http.HandlerFunc {
+			return func(w http.ResponseWriter, req *http.Request) {
+				seasonNum, err := strconv.Atoi(chi.URLParam(req, "season-num"))
+				if err != nil {
+					httpu.BadRequest(w, req, err)
+					return
+				}
+
+				if err = browser.MarkSeasonWatched(req.Context(), chi.URLParam(req, "series-id"), seasonNum, watched); err != nil {
+					httpu.BadGateway(w, req, err)
+					return
+				}
+
+				render.NoContent(w, req)
+			}
+		}
+
+		router.Put("/api/series/{series-id}/seasons/{season-num}/watched", markSeason(true))
+		router.Delete("/api/series/{series-id}/seasons/{season-num}/watched", markSeason(false))
+
+		markEpisode := func(watched bool) http.HandlerFunc {
+			return func(w http.ResponseWriter, req *http.Request) {
+				seasonNum, episodeNum, err := episodeParams(req)
+				if err != nil {
+					httpu.BadRequest(w, req, err)
+					return
+				}
+
+				if err = browser.MarkEpisodeWatched(req.Context(), chi.URLParam(req, "series-id"), seasonNum, episodeNum, watched); err != nil {
+					httpu.BadGateway(w, req, err)
+					return
+				}
+
+				render.NoContent(w, req)
+			}
+		}
+
+		router.Put("/api/series/{series-id}/seasons/{season-num}/episodes/{episode-num}/watched", markEpisode(true))
+		router.Delete("/api/series/{series-id}/seasons/{season-num}/episodes/{episode-num}/watched", markEpisode(false))
+
+		router.Put("/api/series/{series-id}/seasons/{season-num}/episodes/{episode-num}/position", func(w http.ResponseWriter, req *http.Request) {
+			seasonNum, episodeNum, err := episodeParams(req)
+			if err != nil {
+				httpu.BadRequest(w, req, err)
+				return
+			}
+
+			body := struct {
+				// Position in seconds
+				Position int `json:"position"`
+			}{}
+
+			if err = render.DecodeJSON(req.Body, &body); err != nil {
+				httpu.BadRequest(w, req, err)
+				return
+			}
+
+			err = browser.SaveEpisodePosition(req.Context(), chi.URLParam(req, "series-id"), seasonNum, episodeNum, body.Position)
+			if err != nil {
+				httpu.BadGateway(w, req, err)
+				return
+			}
+
+			render.NoContent(w, req)
+		})
+
 		router.Get("/api/movies/{movie-id}", func(w http.ResponseWriter, req *http.Request) {
 			uid := chi.URLParam(req, "movie-id")
-			m, err := browser.Movie(uid)
+			m, err := browser.Movie(req.Context(), uid)
 			if err != nil {
 				httpu.BadGateway(w, req, err)
 				return
@@ -76,7 +205,22 @@ func (browser ContentBrowserImpl) Handler() func(r chi.Router) {
 	}
 }
 
-func (browser ContentBrowserImpl) Season(uid string, seasonNum int) (*domain.Season, error) {
+// episodeParams reads season and episode numbers from the URL
+func episodeParams(req *http.Request) (int, int, error) {
+	seasonNum, err := strconv.Atoi(chi.URLParam(req, "season-num"))
+	if err != nil {
+		return 0, 0, err
+	}
+
+	episodeNum, err := strconv.Atoi(chi.URLParam(req, "episode-num"))
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return seasonNum, episodeNum, nil
+}
+
+func (browser ContentBrowserImpl) Season(ctx context.Context, uid string, seasonNum int) (*domain.Season, error) {
 	if !provider.MatchUIDType(uid, provider.IDTypeTMDB) {
 		return nil, errors.New("Not implemented")
 	}
@@ -86,17 +230,17 @@ func (browser ContentBrowserImpl) Season(uid string, seasonNum int) (*domain.Sea
 		return nil, err
 	}
 
-	season, err := browser.TMDB.GetTVSeason(id, seasonNum)
+	season, err := browser.TMDB.GetTVSeason(ctx, id, seasonNum)
 	if err != nil {
 		return nil, err
 	}
 
-	show, err := browser.TMDB.GetTVShowByID(id)
+	show, err := browser.TMDB.GetTVShowByID(ctx, id)
 	if err != nil {
 		return nil, err
 	}
 
-	ids, err := browser.TMDB.GetTVShowExternalIDS(id)
+	ids, err := browser.TMDB.GetTVShowExternalIDS(ctx, id)
 	if err != nil {
 		return nil, err
 	}
@@ -105,47 +249,184 @@ func (browser ContentBrowserImpl) Season(uid string, seasonNum int) (*domain.Sea
 		return nil, errors.New("Could not load TMDB data")
 	}
 
-	kpi, err := browser.Kinopub.FindItemByIMDB(kinopub.StripImdbID(ids.ImdbID), show.OriginalName)
+	match, err := browser.Kinopub.MatchItem(ctx, tvMatchQuery(ctx, browser.TMDB, browser.Logger, show, ids))
 
 	if err != nil {
 		return nil, err
 	}
 
-	if kpi == nil {
+	if match == nil {
 		return nil, errors.New("Could not find kinopub item")
 	}
 
-	if kpi, err = browser.Kinopub.GetItemById(kpi.ID); kpi != nil {
-		return &domain.Season{
+	kpi, err := browser.Kinopub.GetItemById(ctx, match.Item.ID)
+	if kpi != nil {
+		ds := &domain.Season{
 			UID:        tmdb.ToUID(season.ID),
 			Name:       season.Name,
 			AirDate:    season.AirDate,
 			Number:     season.SeasonNumber,
 			PosterPath: season.PosterPath,
 			Episodes:   toDomainEpisodes(season.SeasonNumber, season.Episodes, kpi),
-		}, nil
+		}
+
+		if kps := kpi.Season(seasonNum); kps != nil {
+			ds.WatchStatus = kinopub.ToDomainWatchStatus(kps.Watching.Status)
+		}
+
+		return ds, nil
 	}
 
 	return nil, err
 }
 
-func (browser ContentBrowserImpl) Show(uid string) (*domain.Series, error) {
+// MarkSeasonWatched marks all the episodes of the season as watched or unwatched in kinopub
+func (browser ContentBrowserImpl) MarkSeasonWatched(ctx context.Context, uid string, seasonNum int, watched bool) error {
+	id, err := browser.kinopubItemID(ctx, uid)
+	if err != nil {
+		return err
+	}
+
+	return browser.Kinopub.MarkSeasonWatched(ctx, id, seasonNum, watched)
+}
+
+// MarkEpisodeWatched marks episode as watched or unwatched in kinopub
+func (browser ContentBrowserImpl) MarkEpisodeWatched(ctx context.Context, uid string, seasonNum int, episodeNum int, watched bool) error {
+	id, err := browser.kinopubItemID(ctx, uid)
+	if err != nil {
+		return err
+	}
+
+	return browser.Kinopub.MarkEpisodeWatched(ctx, id, seasonNum, episodeNum, watched)
+}
+
+// SaveEpisodePosition stores resume position of the episode in kinopub
+func (browser ContentBrowserImpl) SaveEpisodePosition(ctx context.Context, uid string, seasonNum int, episodeNum int, position int) error {
+	id, err := browser.kinopubItemID(ctx, uid)
+	if err != nil {
+		return err
+	}
+
+	return browser.Kinopub.SaveEpisodePosition(ctx, id, seasonNum, episodeNum, position)
+}
+
+// kinopubItemID returns id of the kinopub item that matches the series
+func (browser ContentBrowserImpl) kinopubItemID(ctx context.Context, uid string) (int, error) {
+	if provider.MatchUIDType(uid, provider.IDTypeKinoHub) {
+		return kinopub.ParseUID(uid)
+	}
+
+	if !provider.MatchUIDType(uid, provider.IDTypeTMDB) {
+		return 0, errors.New("Invalid UID")
+	}
+
+	id, err := tmdb.ParseUID(uid)
+	if err != nil {
+		return 0, err
+	}
+
+	q, err := showMatchQuery(ctx, browser.TMDB, browser.Logger, id)
+	if err != nil {
+		return 0, err
+	}
+
+	match, err := browser.Kinopub.MatchItem(ctx, q)
+	if err != nil {
+		return 0, err
+	}
+
+	if match == nil {
+		return 0, errors.New("Could not find kinopub item")
+	}
+
+	return match.Item.ID, nil
+}
+
+// Episode returns TMDB episode merged with the playable data of kinopub one
+func (browser ContentBrowserImpl) Episode(ctx context.Context, uid string, seasonNum int, episodeNum int) (*domain.Episode, error) {
+	if !provider.MatchUIDType(uid, provider.IDTypeTMDB) {
+		return nil, errors.New("Not implemented")
+	}
+
+	id, err := tmdb.ParseUID(uid)
+	if err != nil {
+		return nil, err
+	}
+
+	season, err := browser.TMDB.GetTVSeason(ctx, id, seasonNum)
+	if err != nil {
+		return nil, err
+	}
+
+	show, err := browser.TMDB.GetTVShowByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	ids, err := browser.TMDB.GetTVShowExternalIDS(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if season == nil || show == nil || ids == nil {
+		return nil, errors.New("Could not load TMDB data")
+	}
+
+	for _, episode := range season.Episodes {
+		if episode.EpisodeNumber != episodeNum {
+			continue
+		}
+
+		kpe, err := browser.Kinopub.GetEpisode(ctx, tvMatchQuery(ctx, browser.TMDB, browser.Logger, show, ids), seasonNum, episodeNum)
+		if err != nil {
+			return nil, err
+		}
+
+		de := withKinopubEpisode(episode.ToDomain(), kpe)
+		return &de, nil
+	}
+
+	return nil, nil
+}
+
+// EpisodeStream selects the episode file that matches the stream profile
+func (browser ContentBrowserImpl) EpisodeStream(ctx context.Context, uid string, seasonNum int, episodeNum int, profile string, playerID string) (*domain.Stream, error) {
+	name, p, err := browser.Streams.Resolve(profile, playerID)
+	if err != nil {
+		return nil, err
+	}
+
+	episode, err := browser.Episode(ctx, uid, seasonNum, episodeNum)
+	if err != nil || episode == nil {
+		return nil, err
+	}
+
+	st, err := stream.Select(episode.Files, episode.AudioTracks, p)
+	if err != nil {
+		return nil, err
+	}
+
+	st.Profile = name
+	return st, nil
+}
+
+func (browser ContentBrowserImpl) Show(ctx context.Context, uid string) (*domain.Series, error) {
 	if provider.MatchUIDType(uid, provider.IDTypeKinoHub) {
 		id, _ := kinopub.ParseUID(uid)
 
-		item, err := browser.Kinopub.GetItemById(id)
+		item, err := browser.Kinopub.GetItemById(ctx, id)
 		if err != nil {
 			return nil, err
 		}
 
-		show, err := browser.TMDB.FindTVShowByExternalID(item.ImdbID())
+		show, err := browser.TMDB.FindTVShowByExternalID(ctx, item.ImdbID())
 
 		if err != nil {
 			return nil, err
 		}
 
 		if show != nil {
-			show, err = browser.TMDB.GetTVShowByID(show.ID)
+			show, err = browser.TMDB.GetTVShowByID(ctx, show.ID)
 			if err != nil {
 				return nil, err
 			}
@@ -160,7 +441,7 @@ func (browser ContentBrowserImpl) Show(uid string) (*domain.Series, error) {
 
 	if provider.MatchUIDType(uid, provider.IDTypeTMDB) {
 		id, _ := tmdb.ParseUID(uid)
-		show, err := browser.TMDB.GetTVShowByID(id)
+		show, err := browser.TMDB.GetTVShowByID(ctx, id)
 
 		if err != nil {
 			return nil, err
@@ -179,14 +460,7 @@ func toDomainEpisodes(seasonNumber int, episodes []tmdb.TVEpisode, kpi *kinopub.
 		de := episode.ToDomain()
 
 		if kpi != nil {
-
-			if len(kpi.Seasons) >= seasonNumber {
-				kps := kpi.Seasons[seasonNumber-1]
-
-				if len(kps.Episodes) >= episode.EpisodeNumber {
-					de.Files = kinopub.ToDomainFiles(kps.Episodes[episode.EpisodeNumber-1].Files)
-				}
-			}
+			de = withKinopubEpisode(de, kpi.Episode(seasonNumber, episode.EpisodeNumber))
 		}
 
 		r = append(r, de)
@@ -195,44 +469,107 @@ func toDomainEpisodes(seasonNumber int, episodes []tmdb.TVEpisode, kpi *kinopub.
 	return r
 }
 
-func (browser ContentBrowserImpl) Movie(uid string) (*domain.Movie, error) {
+// withKinopubEpisode adds files, tracks, duration, thumbnail and watching status of kinopub episode to the TMDB one
+func withKinopubEpisode(de domain.Episode, kpe *kinopub.Episode) domain.Episode {
+	if kpe == nil {
+		return de
+	}
 
-	var imdbID string
+	de.Files = kinopub.ToDomainFiles(kpe.Files)
+	de.Duration = kpe.Duration
+	de.Thumbnail = kpe.Thumbnail
+	de.WatchStatus = kinopub.ToDomainWatchStatus(kpe.Watching.Status)
+	de.ResumePosition = kpe.Watching.Time
+	de.Subtitles = kinopub.ToDomainSubtitles(kpe.Subtitles)
+	de.AudioTracks = kinopub.ToDomainAudioTracks(kpe.Audios)
 
-	if provider.MatchUIDType(uid, provider.IDTypeKinoHub) {
-		id, _ := kinopub.ParseUID(uid)
+	return de
+}
 
-		item, err := browser.Kinopub.GetItemById(id)
+// Movie returns TMDB movie merged with the playable data of kinopub one.
+// Kinopub data is used alone if TMDB doesn't know the movie.
+func (browser ContentBrowserImpl) Movie(ctx context.Context, uid string) (*domain.Movie, error) {
+	var movie *tmdb.Movie
+	var kpi *kinopub.Item
+
+	switch {
+	case provider.MatchUIDType(uid, provider.IDTypeKinoHub):
+		id, err := kinopub.ParseUID(uid)
 		if err != nil {
 			return nil, err
 		}
 
-		imdbID = item.ImdbID()
-	}
+		if kpi, err = browser.Kinopub.GetItemById(ctx, id); err != nil {
+			return nil, err
+		}
 
-	movie, err := browser.TMDB.FindMovieByExternalID(imdbID)
+		if movie, err = browser.TMDB.FindMovieByExternalID(ctx, kpi.ImdbID()); err != nil {
+			return nil, err
+		}
 
-	if err != nil {
-		return nil, err
-	}
+		if movie != nil {
+			if movie, err = browser.TMDB.Movie(ctx, movie.ID); err != nil {
+				return nil, err
+			}
+		}
 
-	if movie != nil {
-		movie, err = browser.TMDB.Movie(movie.ID)
+	case provider.MatchUIDType(uid, provider.IDTypeTMDB):
+		id, err := tmdb.ParseUID(uid)
 		if err != nil {
 			return nil, err
 		}
 
+		if movie, err = browser.TMDB.Movie(ctx, id); err != nil {
+			return nil, err
+		}
+
 		if movie != nil {
-			return movie.ToDomain(), nil
+			match, err := browser.Kinopub.MatchItem(ctx, movieMatchQuery(ctx, browser.TMDB, browser.Logger, movie))
+			if err != nil {
+				return nil, err
+			}
+
+			if match != nil {
+				if kpi, err = browser.Kinopub.GetItemById(ctx, match.Item.ID); err != nil {
+					return nil, err
+				}
+			}
 		}
+
+	default:
+		return nil, errors.New("Not supported UID type")
+	}
+
+	if movie != nil {
+		return withKinopubVideo(movie.ToDomain(), kpi), nil
+	}
+
+	if kpi != nil {
+		return withKinopubVideo(kpi.ToDomainMovie(), kpi), nil
+	}
+
+	return nil, errors.New("Could not find the movie")
+}
+
+// withKinopubVideo adds files, subtitles and audio tracks of kinopub movie to the TMDB one
+func withKinopubVideo(dm *domain.Movie, kpi *kinopub.Item) *domain.Movie {
+	if kpi == nil || len(kpi.Videos) == 0 {
+		return dm
 	}
 
-	return nil, errors.New("Not supported UID type")
+	video := kpi.Videos[0]
+	dm.Files = kinopub.ToDomainFiles(video.Files)
+	dm.Subtitles = kinopub.ToDomainSubtitles(video.Subtitles)
+	dm.AudioTracks = kinopub.ToDomainAudioTracks(video.Audios)
+
+	return dm
 }
 
-func NewContentBrowser(kpc kinopub.KinoPubClient, tmdb tmdb.Client) ContentBrowser {
+func NewContentBrowser(kpc kinopub.KinoPubClient, tmdb tmdb.Client, streams *stream.Profiles, logger *logrus.Entry) ContentBrowser {
 	return ContentBrowserImpl{
+		Logger:  logger,
 		Kinopub: kpc,
 		TMDB:    tmdb,
+		Streams: streams,
 	}
 }
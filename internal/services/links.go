@@ -0,0 +1,247 @@
+package services
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+
+	"github.com/dpfg/kinohub-core/internal/provider/kinopub"
+	"github.com/dpfg/kinohub-core/internal/provider/tmdb"
+	httpu "github.com/dpfg/kinohub-core/pkg/http"
+	"github.com/go-chi/chi"
+	"github.com/go-chi/render"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// LinksModule manages overrides of the kinopub items matched to TMDB shows and movies
+type LinksModule struct {
+	Logger  *logrus.Entry
+	Links   *kinopub.LinkStore
+	Kinopub kinopub.KinoPubClient
+	TMDB    tmdb.Client
+}
+
+// Handler returns http.Handler that serves link overrides
+func (mod LinksModule) Handler() http.Handler {
+	router := chi.NewRouter()
+
+	router.Get("/", func(w http.ResponseWriter, req *http.Request) {
+		render.JSON(w, req, mod.Links.All())
+	})
+
+	router.Route("/{link-type}/{tmdb-id}", func(router chi.Router) {
+		router.Get("/", func(w http.ResponseWriter, req *http.Request) {
+			linkType, tmdbID, err := linkParams(req)
+			if err != nil {
+				httpu.BadRequest(w, req, err)
+				return
+			}
+
+			link := mod.Links.Get(linkType, tmdbID)
+			if link == nil {
+				httpu.NotFound(w, req, errors.New("Link is not found"))
+				return
+			}
+
+			render.JSON(w, req, link)
+		})
+
+		// tells which item the lookup finds and how, to debug mismatches
+		router.Get("/match", func(w http.ResponseWriter, req *http.Request) {
+			linkType, tmdbID, err := linkParams(req)
+			if err != nil {
+				httpu.BadRequest(w, req, err)
+				return
+			}
+
+			q, match, err := mod.Match(req.Context(), linkType, tmdbID)
+			if err != nil {
+				httpu.BadGateway(w, req, err)
+				return
+			}
+
+			if match == nil {
+				httpu.NotFound(w, req, errors.New("No matching kinopub item"))
+				return
+			}
+
+			render.JSON(w, req, struct {
+				Query kinopub.MatchQuery `json:"query"`
+				*kinopub.Match
+			}{q, match})
+		})
+
+		router.Put("/", func(w http.ResponseWriter, req *http.Request) {
+			linkType, tmdbID, err := linkParams(req)
+			if err != nil {
+				httpu.BadRequest(w, req, err)
+				return
+			}
+
+			link := kinopub.Link{}
+			if err = render.DecodeJSON(req.Body, &link); err != nil {
+				httpu.BadRequest(w, req, err)
+				return
+			}
+
+			link.Type = linkType
+			link.TMDBID = tmdbID
+
+			if err = link.Validate(); err != nil {
+				httpu.BadRequest(w, req, err)
+				return
+			}
+
+			if err = mod.resolve(req.Context(), &link); err != nil {
+				httpu.BadGateway(w, req, err)
+				return
+			}
+
+			if err = mod.save(&link); err != nil {
+				httpu.InternalError(w, req, err)
+				return
+			}
+
+			render.JSON(w, req, link)
+		})
+
+		router.Delete("/", func(w http.ResponseWriter, req *http.Request) {
+			linkType, tmdbID, err := linkParams(req)
+			if err != nil {
+				httpu.BadRequest(w, req, err)
+				return
+			}
+
+			link, err := mod.Links.Delete(linkType, tmdbID)
+			if err != nil {
+				httpu.InternalError(w, req, err)
+				return
+			}
+
+			if link == nil {
+				httpu.NotFound(w, req, errors.New("Link is not found"))
+				return
+			}
+
+			mod.forget(link)
+			render.NoContent(w, req)
+		})
+	})
+
+	return router
+}
+
+// Put saves the link. Missing IMDB id is taken from TMDB, so the lookups by IMDB id use the link too.
+func (mod LinksModule) Put(ctx context.Context, link *kinopub.Link) error {
+	if err := link.Validate(); err != nil {
+		return err
+	}
+
+	if err := mod.resolve(ctx, link); err != nil {
+		return err
+	}
+
+	return mod.save(link)
+}
+
+// resolve checks that the kinopub item exists and fills in missing IMDB id
+func (mod LinksModule) resolve(ctx context.Context, link *kinopub.Link) error {
+	if _, err := mod.Kinopub.GetItemById(ctx, link.KinopubID); err != nil {
+		return errors.WithMessage(err, "Cannot load kinopub item")
+	}
+
+	if link.ImdbID == "" {
+		imdbID, err := mod.imdbID(ctx, link.Type, link.TMDBID)
+		if err != nil {
+			return err
+		}
+		link.ImdbID = imdbID
+	}
+
+	return nil
+}
+
+// save stores the link and drops the outdated lookups
+func (mod LinksModule) save(link *kinopub.Link) error {
+	if err := mod.Links.Put(*link); err != nil {
+		return err
+	}
+
+	mod.forget(link)
+	return nil
+}
+
+// Match looks up kinopub item of the TMDB entry the same way the content browser does
+func (mod LinksModule) Match(ctx context.Context, linkType string, tmdbID int) (kinopub.MatchQuery, *kinopub.Match, error) {
+	var q kinopub.MatchQuery
+	switch linkType {
+	case kinopub.LinkTypeTV:
+		var err error
+		if q, err = showMatchQuery(ctx, mod.TMDB, mod.Logger, tmdbID); err != nil {
+			return q, nil, err
+		}
+	case kinopub.LinkTypeMovie:
+		movie, err := mod.TMDB.Movie(ctx, tmdbID)
+		if err != nil {
+			return q, nil, errors.WithMessage(err, "Cannot load TMDB movie")
+		}
+		if movie == nil {
+			return q, nil, errors.New("Could not load TMDB data")
+		}
+		q = movieMatchQuery(ctx, mod.TMDB, mod.Logger, movie)
+	default:
+		return q, nil, errors.Errorf("Unknown link type [%s]", linkType)
+	}
+
+	match, err := mod.Kinopub.MatchItem(ctx, q)
+	return q, match, err
+}
+
+func (mod LinksModule) imdbID(ctx context.Context, linkType string, tmdbID int) (string, error) {
+	switch linkType {
+	case kinopub.LinkTypeTV:
+		ids, err := mod.TMDB.GetTVShowExternalIDS(ctx, tmdbID)
+		if err != nil {
+			return "", errors.WithMessage(err, "Cannot load TMDB external ids")
+		}
+		if ids == nil {
+			return "", nil
+		}
+		return ids.ImdbID, nil
+	case kinopub.LinkTypeMovie:
+		movie, err := mod.TMDB.Movie(ctx, tmdbID)
+		if err != nil {
+			return "", errors.WithMessage(err, "Cannot load TMDB movie")
+		}
+		if movie == nil {
+			return "", nil
+		}
+		return movie.ImdbID, nil
+	default:
+		return "", errors.Errorf("Unknown link type [%s]", linkType)
+	}
+}
+
+// forget drops cached lookups, so the outdated match isn't served
+func (mod LinksModule) forget(link *kinopub.Link) {
+	q := kinopub.MatchQuery{Type: link.Type, TMDBID: link.TMDBID, ImdbID: kinopub.StripImdbID(link.ImdbID)}
+	if err := mod.Kinopub.ForgetMatch(q); err != nil {
+		mod.Logger.Warnf("Cannot forget cached lookup of %s [%d]: %s", link.Type, link.TMDBID, err.Error())
+	}
+}
+
+// linkParams reads link type and TMDB id from the URL
+func linkParams(req *http.Request) (string, int, error) {
+	linkType := chi.URLParam(req, "link-type")
+	if linkType != kinopub.LinkTypeTV && linkType != kinopub.LinkTypeMovie {
+		return "", 0, errors.Errorf("Unknown link type [%s]", linkType)
+	}
+
+	tmdbID, err := strconv.Atoi(chi.URLParam(req, "tmdb-id"))
+	if err != nil {
+		return "", 0, err
+	}
+
+	return linkType, tmdbID, nil
+}
@@ -0,0 +1,94 @@
+package services
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	provider "github.com/dpfg/kinohub-core/internal/provider"
+	"github.com/dpfg/kinohub-core/internal/provider/kinopub"
+	"github.com/dpfg/kinohub-core/internal/provider/tmdb"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// linksKinopub counts the item lookups and fails them if asked to
+type linksKinopub struct {
+	kinopub.KinoPubClient
+	lookups int
+	err     error
+}
+
+func (c *linksKinopub) GetItemById(ctx context.Context, id int) (*kinopub.Item, error) {
+	c.lookups++
+	if c.err != nil {
+		return nil, c.err
+	}
+	return &kinopub.Item{ID: id}, nil
+}
+
+func (c *linksKinopub) ForgetMatch(q kinopub.MatchQuery) error {
+	return nil
+}
+
+func TestLinksModule_Put(t *testing.T) {
+	tests := []struct {
+		name        string
+		path        string
+		body        string
+		lookupErr   error
+		wantStatus  int
+		wantLookups int
+	}{
+		{name: "No kinopub id", path: "/tv/1399", body: `{}`, wantStatus: http.StatusBadRequest},
+		{name: "Invalid body", path: "/tv/1399", body: `{`, wantStatus: http.StatusBadRequest},
+		{name: "Unknown type", path: "/episode/1399", body: `{"kinopub_id": 10}`, wantStatus: http.StatusBadRequest},
+		{name: "Invalid TMDB id", path: "/tv/0", body: `{"kinopub_id": 10}`, wantStatus: http.StatusBadRequest},
+		{
+			name:        "Kinopub is down",
+			path:        "/tv/1399",
+			body:        `{"kinopub_id": 10}`,
+			lookupErr:   errors.New("service is down"),
+			wantStatus:  http.StatusBadGateway,
+			wantLookups: 1,
+		},
+		{name: "Saved", path: "/tv/1399", body: `{"kinopub_id": 10}`, wantStatus: http.StatusOK, wantLookups: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "links")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(dir)
+
+			kpc := &linksKinopub{err: tt.lookupErr}
+			mod := LinksModule{
+				Logger:  logrus.NewEntry(logrus.StandardLogger()),
+				Links:   kinopub.NewLinkStore(provider.JSONPreferenceStorage{Path: dir}),
+				Kinopub: kpc,
+				TMDB:    testTMDB{ids: &tmdb.Ids{ImdbID: "tt0944947"}},
+			}
+
+			rec := httptest.NewRecorder()
+			mod.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodPut, tt.path, strings.NewReader(tt.body)))
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("PUT %s = %d, want %d (%s)", tt.path, rec.Code, tt.wantStatus, rec.Body.String())
+			}
+
+			if kpc.lookups != tt.wantLookups {
+				t.Errorf("PUT %s looked up kinopub %d times, want %d", tt.path, kpc.lookups, tt.wantLookups)
+			}
+
+			saved := mod.Links.Get(kinopub.LinkTypeTV, 1399) != nil
+			if wantSaved := tt.wantStatus == http.StatusOK; saved != wantSaved {
+				t.Errorf("PUT %s saved link = %v, want %v", tt.path, saved, wantSaved)
+			}
+		})
+	}
+}
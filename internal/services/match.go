@@ -0,0 +1,97 @@
+package services
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/dpfg/kinohub-core/internal/provider/kinopub"
+	"github.com/dpfg/kinohub-core/internal/provider/tmdb"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// localizedCountry is the country of the titles kinopub is most likely to use
+const localizedCountry = "RU"
+
+// showMatchQuery loads TMDB show and describes it for the kinopub matcher
+func showMatchQuery(ctx context.Context, tm tmdb.Client, logger *logrus.Entry, id int) (kinopub.MatchQuery, error) {
+	show, err := tm.GetTVShowByID(ctx, id)
+	if err != nil {
+		return kinopub.MatchQuery{}, err
+	}
+
+	ids, err := tm.GetTVShowExternalIDS(ctx, id)
+	if err != nil {
+		return kinopub.MatchQuery{}, err
+	}
+
+	if show == nil || ids == nil {
+		return kinopub.MatchQuery{}, errors.New("Could not load TMDB data")
+	}
+
+	return tvMatchQuery(ctx, tm, logger, show, ids), nil
+}
+
+// tvMatchQuery describes TMDB show for the kinopub matcher
+func tvMatchQuery(ctx context.Context, tm tmdb.Client, logger *logrus.Entry, show *tmdb.TVShow, ids *tmdb.Ids) kinopub.MatchQuery {
+	q := kinopub.MatchQuery{
+		Type:          kinopub.LinkTypeTV,
+		TMDBID:        show.ID,
+		ImdbID:        kinopub.StripImdbID(ids.ImdbID),
+		OriginalTitle: show.OriginalName,
+		Year:          yearOf(show.FirstAirDate),
+	}
+
+	withTitles(ctx, tm, logger, &q, tmdb.MediaTypeTV, show.Name)
+	return q
+}
+
+// movieMatchQuery describes TMDB movie for the kinopub matcher
+func movieMatchQuery(ctx context.Context, tm tmdb.Client, logger *logrus.Entry, movie *tmdb.Movie) kinopub.MatchQuery {
+	q := kinopub.MatchQuery{
+		Type:          kinopub.LinkTypeMovie,
+		TMDBID:        movie.ID,
+		ImdbID:        kinopub.StripImdbID(movie.ImdbID),
+		OriginalTitle: movie.OriginalTitle,
+		Year:          yearOf(movie.ReleaseDate),
+	}
+
+	withTitles(ctx, tm, logger, &q, tmdb.MediaTypeMovie, movie.Title)
+	return q
+}
+
+// withTitles sets localized and alternative titles of the query. TMDB names are in English,
+// so the localized title is taken from the alternative ones when there is a Russian one.
+func withTitles(ctx context.Context, tm tmdb.Client, logger *logrus.Entry, q *kinopub.MatchQuery, mediaType string, name string) {
+	q.LocalizedTitle = name
+
+	titles, err := tm.GetAlternativeTitles(ctx, mediaType, q.TMDBID)
+	if err != nil {
+		// the matcher can do without them, so the lookup goes on
+		logger.Warnf("Cannot load alternative titles of %s [%d]: %s", mediaType, q.TMDBID, err.Error())
+		return
+	}
+
+	if titles == nil {
+		return
+	}
+
+	alts := titles.ByCountry(localizedCountry)
+	if local := titles.InCountry(localizedCountry); len(local) > 0 {
+		// titles of the country go first, so it's the localized one
+		q.LocalizedTitle = local[0]
+		alts = append(alts[1:], name)
+	}
+
+	q.AltTitles = alts
+}
+
+// yearOf returns year of the TMDB date (YYYY-MM-DD) or zero if unknown
+func yearOf(date string) int {
+	if len(date) < 4 {
+		return 0
+	}
+
+	year, _ := strconv.Atoi(date[:4])
+	return year
+}
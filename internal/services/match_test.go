@@ -0,0 +1,67 @@
+package services
+
+import (
+	"context"
+	"testing"
+
+	"github.com/dpfg/kinohub-core/internal/provider/kinopub"
+	"github.com/dpfg/kinohub-core/internal/provider/tmdb"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// testTMDB serves a single show and fails to load alternative titles
+type testTMDB struct {
+	tmdb.Client
+	show *tmdb.TVShow
+	ids  *tmdb.Ids
+}
+
+func (c testTMDB) GetTVShowByID(ctx context.Context, id int) (*tmdb.TVShow, error) {
+	return c.show, nil
+}
+
+func (c testTMDB) GetTVShowExternalIDS(ctx context.Context, id int) (*tmdb.Ids, error) {
+	return c.ids, nil
+}
+
+func (c testTMDB) GetAlternativeTitles(ctx context.Context, mediaType string, id int) (*tmdb.AlternativeTitles, error) {
+	return nil, errors.New("alternative titles are unavailable")
+}
+
+// testKinopub records the match query and the watched season
+type testKinopub struct {
+	kinopub.KinoPubClient
+	query   kinopub.MatchQuery
+	watched int
+}
+
+func (c *testKinopub) MatchItem(ctx context.Context, q kinopub.MatchQuery) (*kinopub.Match, error) {
+	c.query = q
+	return &kinopub.Match{Item: &kinopub.Item{ID: 42}}, nil
+}
+
+func (c *testKinopub) MarkSeasonWatched(ctx context.Context, itemID int, seasonNum int, watched bool) error {
+	c.watched = itemID
+	return nil
+}
+
+func TestContentBrowser_AltTitlesFail(t *testing.T) {
+	show := &tmdb.TVShow{ID: 1399, Name: "Game of Thrones", OriginalName: "Game of Thrones", FirstAirDate: "2011-04-17"}
+	tm := testTMDB{show: show, ids: &tmdb.Ids{ImdbID: "tt0944947"}}
+	kpc := &testKinopub{}
+
+	browser := NewContentBrowser(kpc, tm, nil, logrus.NewEntry(logrus.StandardLogger()))
+	if err := browser.MarkSeasonWatched(context.Background(), tmdb.ToUID(show.ID), 1, true); err != nil {
+		t.Fatalf("MarkSeasonWatched() error = %v", err)
+	}
+
+	if kpc.watched != 42 {
+		t.Errorf("MarkSeasonWatched() marked item %d, want 42", kpc.watched)
+	}
+
+	want := kinopub.MatchQuery{Type: kinopub.LinkTypeTV, TMDBID: 1399, ImdbID: 944947, OriginalTitle: "Game of Thrones", LocalizedTitle: "Game of Thrones", Year: 2011}
+	if q := kpc.query; q.LocalizedTitle != want.LocalizedTitle || q.ImdbID != want.ImdbID || q.Year != want.Year || len(q.AltTitles) != 0 {
+		t.Errorf("MatchItem() query = %+v, want %+v", q, want)
+	}
+}
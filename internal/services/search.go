@@ -1,7 +1,15 @@
 package services
 
 import (
+	"context"
 	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
 
 	httpu "github.com/dpfg/kinohub-core/pkg/http"
 
@@ -25,7 +33,17 @@ func (cs ContentSearch) Handler() http.Handler {
 	router := chi.NewRouter()
 
 	router.Get("/", func(w http.ResponseWriter, req *http.Request) {
-		result, err := cs.Search(req.URL.Query().Get("q"))
+		filter, err := parseItemsFilter(req.URL.Query())
+		if err == nil {
+			err = filter.Validate()
+		}
+
+		if err != nil {
+			httpu.BadRequest(w, req, err)
+			return
+		}
+
+		result, err := cs.Search(req.Context(), filter)
 		if err != nil {
 			httpu.InternalError(w, req, err)
 			return
@@ -36,35 +54,370 @@ func (cs ContentSearch) Handler() http.Handler {
 	return router
 }
 
-func (cs ContentSearch) Search(q string) ([]domain.SearchResult, error) {
-	r, err := cs.Kinopub.SearchItemBy(kinopub.ItemsFilter{
-		Title: q,
-	})
+// parseItemsFilter reads catalogue filter from the query parameters:
+// q, type, genre, country, quality (comma separated ids), year_from, year_to, sort, page and per_page.
+func parseItemsFilter(q url.Values) (kinopub.ItemsFilter, error) {
+	filter := kinopub.ItemsFilter{
+		Title: q.Get("q"),
+		Type:  q.Get("type"),
+		Sort:  q.Get("sort"),
+	}
+
+	ints := []struct {
+		name  string
+		value *int
+	}{
+		{"year_from", &filter.YearFrom},
+		{"year_to", &filter.YearTo},
+		{"page", &filter.Page},
+		{"per_page", &filter.PerPage},
+	}
+	for _, p := range ints {
+		if v := q.Get(p.name); v != "" {
+			i, err := strconv.Atoi(v)
+			if err != nil {
+				return filter, errors.Errorf("Invalid value of [%s]: %s", p.name, v)
+			}
+			*p.value = i
+		}
+	}
+
+	lists := []struct {
+		name  string
+		value *[]int
+	}{
+		{"genre", &filter.Genres},
+		{"country", &filter.Countries},
+		{"quality", &filter.Quality},
+	}
+	for _, p := range lists {
+		if v := q.Get(p.name); v != "" {
+			for _, s := range strings.Split(v, ",") {
+				i, err := strconv.Atoi(strings.TrimSpace(s))
+				if err != nil {
+					return filter, errors.Errorf("Invalid value of [%s]: %s", p.name, v)
+				}
+				*p.value = append(*p.value, i)
+			}
+		}
+	}
+
+	return filter, nil
+}
+
+// Search returns a page of kinopub items that match the filter. Searches by title only
+// are merged with TMDB titles, the playable ones first. A failure of one of the sources
+// is tolerated then, so the titles of the other are still returned.
+func (cs ContentSearch) Search(ctx context.Context, filter kinopub.ItemsFilter) (*domain.SearchResults, error) {
+	if !searchesTMDB(filter) {
+		page, err := cs.Kinopub.SearchItemBy(ctx, filter)
+		if err != nil {
+			return nil, err
+		}
+
+		return toSearchResults(page), nil
+	}
+
+	var (
+		wg     sync.WaitGroup
+		kpPage *kinopub.ItemsPage
+		kpErr  error
+		tmPage *tmdb.MultiSearchResults
+		tmErr  error
+	)
+
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		kpPage, kpErr = cs.Kinopub.SearchItemBy(ctx, filter)
+	}()
+
+	go func() {
+		defer wg.Done()
+		tmPage, tmErr = cs.TMDB.SearchMulti(ctx, filter.Title, filter.Page)
+	}()
+
+	wg.Wait()
+
+	if kpErr != nil && tmErr != nil {
+		return nil, errors.WithMessage(kpErr, "Cannot search kinopub nor TMDB")
+	}
+
+	result := &domain.SearchResults{}
+	items := make([]kinopub.Item, 0)
+	hits := make([]tmdbHit, 0)
+
+	if kpErr != nil {
+		cs.Logger.Warnf("Cannot search kinopub: %s", kpErr.Error())
+	} else {
+		items = kpPage.Items
+		result.Pagination = toDomainPagination(kpPage.Pagination)
+	}
 
-	if err != nil {
-		return nil, err
+	if tmErr != nil {
+		cs.Logger.Warnf("Cannot search TMDB: %s", tmErr.Error())
+	} else {
+		hits = cs.withImdbIDs(ctx, toTMDBHits(tmPage.Results), items)
+		result.TMDBPagination = &domain.Pagination{
+			Page:       tmPage.Page,
+			Pages:      tmPage.TotalPages,
+			PerPage:    tmdb.SearchPageSize,
+			TotalItems: tmPage.TotalResults,
+		}
 	}
 
-	result := make([]domain.SearchResult, 0)
-	for _, item := range r {
-		// tmdbItem, err := cs.TMDB.FindTVShowByExternalID(item.ImdbID())
-		// if err != nil {
-		// 	cs.Logger.Error(errors.WithMessage(err, "cannot load TMDB entry by IMDB id").Error())
-		// 	continue
-		// }
+	result.Items = mergeSearchResults(filter.Title, hits, items)
+	return result, nil
+}
 
-		// if tmdbItem == nil {
-		// 	cs.Logger.Debugf("Skip search result item [%d]", item.ID)
-		// 	continue
-		// }
+// searchesTMDB tells whether TMDB titles are merged into the results. TMDB can't apply
+// the catalogue filters, so it's searched by title only.
+func searchesTMDB(filter kinopub.ItemsFilter) bool {
+	return filter.Title != "" && filter.Type == "" && filter.Sort == "" &&
+		filter.YearFrom == 0 && filter.YearTo == 0 &&
+		len(filter.Genres) == 0 && len(filter.Countries) == 0 && len(filter.Quality) == 0
+}
 
+// toSearchResults converts page of kinopub items
+func toSearchResults(page *kinopub.ItemsPage) *domain.SearchResults {
+	return &domain.SearchResults{
+		Items:      toSearchResultList(page.Items),
+		Pagination: toDomainPagination(page.Pagination),
+	}
+}
+
+func toSearchResultList(items []kinopub.Item) []domain.SearchResult {
+	result := make([]domain.SearchResult, 0, len(items))
+	for _, item := range items {
 		result = append(result, domain.SearchResult{
 			UID:        kinopub.ToUID(item.ID),
 			Type:       item.DomainType(),
 			Title:      item.Title,
 			PosterPath: item.Posters.Big,
+			Year:       item.Year,
+			Playable:   true,
 		})
 	}
 
-	return result, nil
+	return result
+}
+
+func toDomainPagination(p kinopub.Pagination) domain.Pagination {
+	return domain.Pagination{
+		Page:       p.Current,
+		Pages:      p.Total,
+		PerPage:    p.PerPage,
+		TotalItems: p.TotalItems,
+	}
+}
+
+const (
+	// externalIDWorkers limits concurrent TMDB requests for IMDB ids of the found titles
+	externalIDWorkers = 4
+	// maxImdbLookups limits the number of the found titles IMDB ids are looked up for
+	maxImdbLookups = 5
+)
+
+// tmdbHit is TMDB show or movie found by the query along with its IMDB id
+type tmdbHit struct {
+	tmdb.MultiSearchResult
+	ImdbID int
+}
+
+// toTMDBHits keeps TV shows and movies of the search results
+func toTMDBHits(results []tmdb.MultiSearchResult) []tmdbHit {
+	hits := make([]tmdbHit, 0, len(results))
+	for _, r := range results {
+		if r.MediaType == tmdb.MediaTypeTV || r.MediaType == tmdb.MediaTypeMovie {
+			hits = append(hits, tmdbHit{MultiSearchResult: r})
+		}
+	}
+
+	return hits
+}
+
+// withImdbIDs looks up IMDB ids of the hits kinopub items can't be matched to by title.
+// Nothing is looked up once every kinopub item with IMDB id is matched, and only the most
+// relevant of the rest are looked up. Titles with unknown id are kept too.
+func (cs ContentSearch) withImdbIDs(ctx context.Context, hits []tmdbHit, items []kinopub.Item) []tmdbHit {
+	merged := make(map[int]bool)
+	pending := make([]int, 0, maxImdbLookups)
+	for i := range hits {
+		if j, ok := titleMatch(hits[i], items, merged); ok {
+			merged[j] = true
+		} else if len(pending) < maxImdbLookups {
+			pending = append(pending, i)
+		}
+	}
+
+	unmatched := false
+	for i, item := range items {
+		unmatched = unmatched || (item.Imdb != 0 && !merged[i])
+	}
+
+	if !unmatched {
+		return hits
+	}
+
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, externalIDWorkers)
+	for _, i := range pending {
+		wg.Add(1)
+		go func(hit *tmdbHit) {
+			defer wg.Done()
+
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			imdbID, err := cs.imdbID(ctx, hit.MediaType, hit.ID)
+			if err != nil {
+				cs.Logger.Debugf("Cannot load IMDB id of %s [%d]: %s", hit.MediaType, hit.ID, err.Error())
+				return
+			}
+			hit.ImdbID = kinopub.StripImdbID(imdbID)
+		}(&hits[i])
+	}
+	wg.Wait()
+
+	return hits
+}
+
+func (cs ContentSearch) imdbID(ctx context.Context, mediaType string, id int) (string, error) {
+	if mediaType == tmdb.MediaTypeTV {
+		ids, err := cs.TMDB.GetTVShowExternalIDS(ctx, id)
+		if err != nil || ids == nil {
+			return "", err
+		}
+		return ids.ImdbID, nil
+	}
+
+	movie, err := cs.TMDB.Movie(ctx, id)
+	if err != nil || movie == nil {
+		return "", err
+	}
+	return movie.ImdbID, nil
+}
+
+// rankedResult is search result along with the titles it's ranked by
+type rankedResult struct {
+	domain.SearchResult
+	titles []string
+}
+
+// mergeSearchResults returns one result per title. TMDB ones come with the posters and are
+// playable if kinopub has the same IMDB id or title, the rest of kinopub items follow them.
+// Playable titles go first, then the ones that match the query exactly.
+func mergeSearchResults(query string, hits []tmdbHit, items []kinopub.Item) []domain.SearchResult {
+	byImdb := make(map[int]int, len(items))
+	for i, item := range items {
+		if _, ok := byImdb[item.Imdb]; item.Imdb != 0 && !ok {
+			byImdb[item.Imdb] = i
+		}
+	}
+
+	merged := make(map[int]bool)
+	ranked := make([]rankedResult, 0, len(hits)+len(items))
+
+	for _, hit := range hits {
+		title, original := hit.Titles()
+		r := rankedResult{
+			SearchResult: domain.SearchResult{
+				UID:        tmdb.ToUID(hit.ID),
+				Type:       domain.TypeMovie,
+				Title:      title,
+				PosterPath: tmdb.ImagePath(hit.PosterPath, 300),
+				Year:       hit.Year(),
+			},
+			titles: []string{title, original},
+		}
+
+		if hit.MediaType == tmdb.MediaTypeTV {
+			r.Type = domain.TypeSerial
+		}
+
+		i, ok := byImdb[hit.ImdbID]
+		if !ok || hit.ImdbID == 0 || merged[i] {
+			i, ok = titleMatch(hit, items, merged)
+		}
+
+		if ok {
+			merged[i] = true
+			r.Playable = true
+			r.titles = append(r.titles, strings.Split(items[i].Title, "/")...)
+			if r.PosterPath == "" {
+				r.PosterPath = items[i].Posters.Big
+			}
+		}
+
+		ranked = append(ranked, r)
+	}
+
+	for i, item := range items {
+		if merged[i] {
+			continue
+		}
+
+		ranked = append(ranked, rankedResult{
+			SearchResult: toSearchResultList([]kinopub.Item{item})[0],
+			titles:       strings.Split(item.Title, "/"),
+		})
+	}
+
+	q := kinopub.NormalizeTitle(query)
+	rank := func(r rankedResult) int {
+		score := 0
+		if r.Playable {
+			score += 2
+		}
+
+		for _, t := range r.titles {
+			if kinopub.NormalizeTitle(t) == q {
+				score++
+				break
+			}
+		}
+
+		return score
+	}
+
+	// providers order the results by relevance, so it's kept within the same rank
+	sort.SliceStable(ranked, func(i, j int) bool { return rank(ranked[i]) > rank(ranked[j]) })
+
+	results := make([]domain.SearchResult, 0, len(ranked))
+	for _, r := range ranked {
+		results = append(results, r.SearchResult)
+	}
+
+	return results
+}
+
+// titleMatch returns the kinopub item of the same type, year and title as the hit, unless their IMDB ids differ
+func titleMatch(hit tmdbHit, items []kinopub.Item, merged map[int]bool) (int, bool) {
+	year := hit.Year()
+	if year == 0 {
+		return 0, false
+	}
+
+	title, original := hit.Titles()
+	titles := []string{kinopub.NormalizeTitle(title), kinopub.NormalizeTitle(original)}
+	itemType := domain.TypeMovie
+	if hit.MediaType == tmdb.MediaTypeTV {
+		itemType = domain.TypeSerial
+	}
+
+	for i := range items {
+		item := &items[i]
+		if merged[i] || item.Year != year || item.DomainType() != itemType ||
+			(hit.ImdbID != 0 && item.Imdb != 0 && hit.ImdbID != item.Imdb) {
+			continue
+		}
+
+		for _, part := range strings.Split(item.Title, "/") {
+			if part = kinopub.NormalizeTitle(part); part != "" && (part == titles[0] || part == titles[1]) {
+				return i, true
+			}
+		}
+	}
+
+	return 0, false
 }
@@ -0,0 +1,156 @@
+package services
+
+import (
+	"context"
+	"reflect"
+	"sync/atomic"
+	"testing"
+
+	"github.com/dpfg/kinohub-core/domain"
+	"github.com/dpfg/kinohub-core/internal/provider/kinopub"
+	"github.com/dpfg/kinohub-core/internal/provider/tmdb"
+	"github.com/sirupsen/logrus"
+)
+
+func TestMergeSearchResults(t *testing.T) {
+	hits := []tmdbHit{
+		{MultiSearchResult: tmdb.MultiSearchResult{ID: 1, MediaType: tmdb.MediaTypeMovie, Title: "The Dark Knight", ReleaseDate: "2008-07-16", PosterPath: "/knight.jpg"}, ImdbID: 468569},
+		{MultiSearchResult: tmdb.MultiSearchResult{ID: 2, MediaType: tmdb.MediaTypeTV, Name: "Dark", OriginalName: "Dark", FirstAirDate: "2017-12-01", PosterPath: "/dark.jpg"}, ImdbID: 5753856},
+		{MultiSearchResult: tmdb.MultiSearchResult{ID: 3, MediaType: tmdb.MediaTypeMovie, Title: "Dark", ReleaseDate: "2015-01-01"}},
+		{MultiSearchResult: tmdb.MultiSearchResult{ID: 4, MediaType: tmdb.MediaTypeTV, Name: "Dark Matter", FirstAirDate: "2015-06-12"}, ImdbID: 4159076},
+		// IMDB id hasn't been looked up, so it's matched by title
+		{MultiSearchResult: tmdb.MultiSearchResult{ID: 5, MediaType: tmdb.MediaTypeMovie, Title: "Dark Waters", ReleaseDate: "2019-11-22", PosterPath: "/waters.jpg"}},
+	}
+
+	items := []kinopub.Item{
+		{ID: 10, Type: kinopub.ItemTypeSerial, Title: "Тьма / Dark", Year: 2017, Imdb: 5753856},
+		{ID: 11, Type: kinopub.ItemTypeSerial, Title: "Темная материя / Dark Matter", Year: 2015, Imdb: 4159076},
+		{ID: 12, Type: kinopub.ItemTypeMovie, Title: "Темные воды / Dark Waters", Year: 2019},
+		{ID: 13, Type: kinopub.ItemTypeMovie, Title: "Темный рыцарь / The Dark Knight", Year: 2008, Imdb: 1},
+	}
+
+	got := mergeSearchResults("dark", hits, items)
+
+	want := []domain.SearchResult{
+		{UID: tmdb.ToUID(2), Type: domain.TypeSerial, Title: "Dark", PosterPath: tmdb.ImagePath("/dark.jpg", 300), Year: 2017, Playable: true},
+		{UID: tmdb.ToUID(4), Type: domain.TypeSerial, Title: "Dark Matter", Year: 2015, Playable: true},
+		{UID: tmdb.ToUID(5), Type: domain.TypeMovie, Title: "Dark Waters", PosterPath: tmdb.ImagePath("/waters.jpg", 300), Year: 2019, Playable: true},
+		// the same title, but different IMDB id
+		{UID: kinopub.ToUID(13), Type: domain.TypeMovie, Title: "Темный рыцарь / The Dark Knight", Year: 2008, Playable: true},
+		{UID: tmdb.ToUID(3), Type: domain.TypeMovie, Title: "Dark", Year: 2015},
+		{UID: tmdb.ToUID(1), Type: domain.TypeMovie, Title: "The Dark Knight", PosterPath: tmdb.ImagePath("/knight.jpg", 300), Year: 2008},
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("mergeSearchResults() =\n%+v\nwant\n%+v", got, want)
+	}
+}
+
+// searchKinopub returns the same page for any filter
+type searchKinopub struct {
+	kinopub.KinoPubClient
+	items []kinopub.Item
+}
+
+func (c searchKinopub) SearchItemBy(ctx context.Context, q kinopub.ItemsFilter) (*kinopub.ItemsPage, error) {
+	return &kinopub.ItemsPage{Items: c.items, Pagination: kinopub.Pagination{Total: 1, Current: 1, PerPage: 20, TotalItems: len(c.items)}}, nil
+}
+
+// searchTMDB returns the same page for any query and counts IMDB id lookups
+type searchTMDB struct {
+	tmdb.Client
+	results  []tmdb.MultiSearchResult
+	searches *int32
+	lookups  *int32
+}
+
+func (c searchTMDB) SearchMulti(ctx context.Context, query string, page int) (*tmdb.MultiSearchResults, error) {
+	atomic.AddInt32(c.searches, 1)
+	return &tmdb.MultiSearchResults{Page: 1, Results: c.results, TotalPages: 3, TotalResults: 60}, nil
+}
+
+func (c searchTMDB) GetTVShowExternalIDS(ctx context.Context, id int) (*tmdb.Ids, error) {
+	atomic.AddInt32(c.lookups, 1)
+	return &tmdb.Ids{ImdbID: "tt5753856"}, nil
+}
+
+func (c searchTMDB) Movie(ctx context.Context, id int) (*tmdb.Movie, error) {
+	atomic.AddInt32(c.lookups, 1)
+	return &tmdb.Movie{}, nil
+}
+
+func TestContentSearch_Search(t *testing.T) {
+	darkTV := tmdb.MultiSearchResult{ID: 1, MediaType: tmdb.MediaTypeTV, Name: "Dark", FirstAirDate: "2017-12-01"}
+	results := []tmdb.MultiSearchResult{darkTV}
+	for i := 2; i < 20; i++ {
+		results = append(results, tmdb.MultiSearchResult{ID: i, MediaType: tmdb.MediaTypeMovie, Title: "Dark", ReleaseDate: "1990-01-01"})
+	}
+
+	tests := []struct {
+		name         string
+		filter       kinopub.ItemsFilter
+		items        []kinopub.Item
+		wantSearches int32
+		wantLookups  int32
+		wantPlayable bool
+	}{
+		{
+			name:         "Matched by title",
+			filter:       kinopub.ItemsFilter{Title: "dark"},
+			items:        []kinopub.Item{{ID: 10, Type: kinopub.ItemTypeSerial, Title: "Тьма / Dark", Year: 2017, Imdb: 5753856}},
+			wantSearches: 1,
+			wantPlayable: true,
+		},
+		{
+			name:         "Localized title only",
+			filter:       kinopub.ItemsFilter{Title: "dark"},
+			items:        []kinopub.Item{{ID: 10, Type: kinopub.ItemTypeSerial, Title: "Тьма", Year: 2017, Imdb: 5753856}},
+			wantSearches: 1,
+			wantLookups:  maxImdbLookups,
+			wantPlayable: true,
+		},
+		{
+			name:         "No IMDB ids on kinopub",
+			filter:       kinopub.ItemsFilter{Title: "dark"},
+			items:        []kinopub.Item{{ID: 10, Type: kinopub.ItemTypeSerial, Title: "Тьма", Year: 2017}},
+			wantSearches: 1,
+		},
+		{
+			name:   "Catalogue filter",
+			filter: kinopub.ItemsFilter{Title: "dark", Type: kinopub.ItemTypeSerial},
+			items:  []kinopub.Item{{ID: 10, Type: kinopub.ItemTypeSerial, Title: "Тьма", Year: 2017, Imdb: 5753856}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var searches, lookups int32
+			cs := ContentSearch{
+				Logger:  logrus.NewEntry(logrus.StandardLogger()),
+				Kinopub: searchKinopub{items: tt.items},
+				TMDB:    searchTMDB{results: results, searches: &searches, lookups: &lookups},
+			}
+
+			got, err := cs.Search(context.Background(), tt.filter)
+			if err != nil {
+				t.Fatalf("Search() error = %v", err)
+			}
+
+			if searches != tt.wantSearches || lookups != tt.wantLookups {
+				t.Errorf("Search() made %d TMDB searches and %d lookups, want %d and %d", searches, lookups, tt.wantSearches, tt.wantLookups)
+			}
+
+			if (got.TMDBPagination != nil) != (tt.wantSearches > 0) {
+				t.Errorf("Search() TMDB pagination = %+v", got.TMDBPagination)
+			}
+
+			if got.Pagination.Page != 1 || got.Pagination.TotalItems != len(tt.items) {
+				t.Errorf("Search() kinopub pagination = %+v", got.Pagination)
+			}
+
+			first := got.Items[0]
+			if playable := first.UID == tmdb.ToUID(darkTV.ID) && first.Playable; playable != tt.wantPlayable {
+				t.Errorf("Search() first result = %+v, want merged %v", first, tt.wantPlayable)
+			}
+		})
+	}
+}
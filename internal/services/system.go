@@ -3,17 +3,100 @@ package services
 import (
 	"net/http"
 
+	"github.com/pkg/errors"
+
+	provider "github.com/dpfg/kinohub-core/internal/provider"
+	"github.com/dpfg/kinohub-core/internal/provider/kinopub"
+	"github.com/dpfg/kinohub-core/internal/provider/tmdb"
+	httpu "github.com/dpfg/kinohub-core/pkg/http"
 	"github.com/go-chi/chi"
+	"github.com/go-chi/render"
 )
 
+// SystemModule exposes maintenance endpoints of the server
 type SystemModule struct {
+	Cache   provider.CacheAdmin
+	Kinopub kinopub.KinoPubClient
+	TMDB    tmdb.Client
 }
 
+// Handler returns http.Handler that serves system-related requests
 func (mod SystemModule) Handler() http.Handler {
 	router := chi.NewRouter()
 
+	router.Get("/cache", func(w http.ResponseWriter, req *http.Request) {
+		stats, err := mod.Cache.Stats()
+		if err != nil {
+			httpu.InternalError(w, req, err)
+			return
+		}
+
+		render.JSON(w, req, stats)
+	})
+
 	router.Delete("/cache", func(w http.ResponseWriter, req *http.Request) {
+		if err := mod.Cache.PurgeAll(); err != nil {
+			httpu.InternalError(w, req, err)
+			return
+		}
+
+		render.NoContent(w, req)
+	})
+
+	router.Post("/cache/sweep", func(w http.ResponseWriter, req *http.Request) {
+		report, err := mod.Cache.Sweep()
+		if err != nil {
+			httpu.InternalError(w, req, err)
+			return
+		}
+
+		render.JSON(w, req, report)
+	})
+
+	router.Delete("/cache/{cache-name}", func(w http.ResponseWriter, req *http.Request) {
+		cacheName := chi.URLParam(req, "cache-name")
+
+		var err error
+		if key := req.URL.Query().Get("key"); key != "" {
+			err = mod.Cache.PurgeKey(cacheName, key)
+		} else {
+			err = mod.Cache.Purge(cacheName)
+		}
+
+		if err == provider.ErrCacheNotFound {
+			httpu.NotFound(w, req, err)
+			return
+		}
+
+		if err != nil {
+			httpu.InternalError(w, req, err)
+			return
+		}
+
+		render.NoContent(w, req)
+	})
+
+	// drops cached results of the cross-provider lookups, e.g. after the ID mapping is fixed
+	router.Delete("/lookups/{imdb-id}", func(w http.ResponseWriter, req *http.Request) {
+		imdbID := chi.URLParam(req, "imdb-id")
+
+		id := kinopub.StripImdbID(imdbID)
+		if id == 0 {
+			httpu.BadRequest(w, req, errors.Errorf("Invalid IMDB id [%s]", imdbID))
+			return
+		}
+
+		if err := mod.Kinopub.ForgetMatch(kinopub.MatchQuery{ImdbID: id}); err != nil {
+			httpu.InternalError(w, req, err)
+			return
+		}
+
+		if err := mod.TMDB.ForgetExternalID(kinopub.ToImdbID(id)); err != nil {
+			httpu.InternalError(w, req, err)
+			return
+		}
 
+		render.NoContent(w, req)
 	})
 
 	return router
@@ -0,0 +1,237 @@
+package services
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/go-chi/render"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+
+	"github.com/dpfg/kinohub-core/internal/provider/kinopub"
+	"github.com/dpfg/kinohub-core/internal/provider/tmdb"
+	"github.com/dpfg/kinohub-core/internal/provider/trakt"
+)
+
+// WarmUpSchedule defines when the warm-up runs. Daily time takes precedence over the interval.
+type WarmUpSchedule struct {
+	// At is the daily time of the run in the 15:04 format
+	At string
+	// Interval between the runs. Zero disables periodic runs.
+	Interval time.Duration
+	// Days is the number of the coming days to prefetch releases for
+	Days int
+}
+
+// WarmUpStatus describes the last run of the warm-up
+type WarmUpStatus struct {
+	Running    bool      `json:"running"`
+	StartedAt  time.Time `json:"started_at,omitempty"`
+	FinishedAt time.Time `json:"finished_at,omitempty"`
+	NextRunAt  time.Time `json:"next_run_at,omitempty"`
+	Shows      int       `json:"shows"`
+	Episodes   int       `json:"episodes"`
+	Errors     []string  `json:"errors,omitempty"`
+}
+
+// WarmUp prefetches metadata of the upcoming episodes of the followed shows,
+// so the first requests of the day are served from the cache.
+type WarmUp struct {
+	schedule WarmUpSchedule
+	at       *time.Time
+	now      func() time.Time
+	tc       releaseCalendar
+	kpc      kinopub.KinoPubClient
+	tmdbCli  tmdb.Client
+	logger   *logrus.Entry
+
+	mu     sync.Mutex
+	status WarmUpStatus
+}
+
+// NewWarmUp creates warm-up job. Call Schedule to start periodic runs.
+func NewWarmUp(schedule WarmUpSchedule, tc *trakt.Client, kpc kinopub.KinoPubClient, tmdb tmdb.Client, logger *logrus.Entry) (*WarmUp, error) {
+	wu := &WarmUp{
+		schedule: schedule,
+		now:      time.Now,
+		tc:       tc,
+		kpc:      kpc,
+		tmdbCli:  tmdb,
+		logger:   logger,
+	}
+
+	if schedule.At != "" {
+		at, err := time.Parse("15:04", schedule.At)
+		if err != nil {
+			return nil, errors.Wrap(err, "Invalid warm-up time")
+		}
+		wu.at = &at
+	}
+
+	return wu, nil
+}
+
+// Handler returns chi.Router registrar to trigger warm-up and check its status
+func (wu *WarmUp) Handler() func(r chi.Router) {
+
+	return func(router chi.Router) {
+
+		router.Get("/api/system/warmup", func(w http.ResponseWriter, req *http.Request) {
+			render.JSON(w, req, wu.Status())
+		})
+
+		router.Post("/api/system/warmup", func(w http.ResponseWriter, req *http.Request) {
+			if !wu.start() {
+				render.Status(req, http.StatusConflict)
+				render.JSON(w, req, wu.Status())
+				return
+			}
+
+			// warm-up outlives the request that has started it
+			go wu.run(context.Background())
+
+			render.Status(req, http.StatusAccepted)
+			render.JSON(w, req, wu.Status())
+		})
+	}
+}
+
+// Status returns a snapshot of the warm-up status
+func (wu *WarmUp) Status() WarmUpStatus {
+	wu.mu.Lock()
+	defer wu.mu.Unlock()
+
+	return wu.status
+}
+
+// Schedule runs the warm-up periodically. It blocks, so it should be run in a separate goroutine.
+func (wu *WarmUp) Schedule() {
+	if wu.at == nil && wu.schedule.Interval <= 0 {
+		wu.logger.Infoln("Warm-up schedule is not configured")
+		return
+	}
+
+	for {
+		next := wu.nextRun(wu.now())
+
+		wu.mu.Lock()
+		wu.status.NextRunAt = next
+		wu.mu.Unlock()
+
+		wu.logger.Infof("Next warm-up is scheduled at %s", next.Format(time.RFC3339))
+		time.Sleep(next.Sub(wu.now()))
+
+		if wu.start() {
+			wu.run(context.Background())
+		}
+	}
+}
+
+// nextRun returns time of the next run after now
+func (wu *WarmUp) nextRun(now time.Time) time.Time {
+	if wu.at == nil {
+		return now.Add(wu.schedule.Interval)
+	}
+
+	next := time.Date(now.Year(), now.Month(), now.Day(), wu.at.Hour(), wu.at.Minute(), 0, 0, now.Location())
+	if !next.After(now) {
+		next = next.AddDate(0, 0, 1)
+	}
+
+	return next
+}
+
+// start marks the warm-up as running unless it's running already
+func (wu *WarmUp) start() bool {
+	wu.mu.Lock()
+	defer wu.mu.Unlock()
+
+	if wu.status.Running {
+		return false
+	}
+
+	wu.status = WarmUpStatus{
+		Running:   true,
+		StartedAt: wu.now(),
+		NextRunAt: wu.status.NextRunAt,
+	}
+
+	return true
+}
+
+func (wu *WarmUp) run(ctx context.Context) {
+	wu.logger.Infoln("Warm-up has been started")
+
+	shows, episodes, errs := wu.prefetch(ctx)
+
+	wu.mu.Lock()
+	wu.status.Running = false
+	wu.status.FinishedAt = wu.now()
+	wu.status.Shows = shows
+	wu.status.Episodes = episodes
+	wu.status.Errors = make([]string, 0, len(errs))
+	for _, err := range errs {
+		wu.status.Errors = append(wu.status.Errors, err.Error())
+	}
+	wu.mu.Unlock()
+
+	wu.logger.Infof("Warm-up has been finished: shows=%d episodes=%d errors=%d", shows, episodes, len(errs))
+}
+
+// prefetch loads all the data used by the feed and season pages for the upcoming episodes
+func (wu *WarmUp) prefetch(ctx context.Context) (int, int, []error) {
+	from := wu.now()
+	to := from.AddDate(0, 0, wu.schedule.Days)
+
+	calendar, err := wu.tc.MyShows(ctx, from, to)
+	if err != nil {
+		return 0, 0, []error{errors.WithMessage(err, "Cannot load Trakt calendar")}
+	}
+
+	errs := make([]error, 0)
+	check := func(err error, msg string) {
+		if err != nil {
+			wu.logger.Warnf("%s: %s", msg, err.Error())
+			errs = append(errs, errors.WithMessage(err, msg))
+		}
+	}
+
+	shows := make(map[int]bool)
+	seasons := make(map[[2]int]bool)
+
+	for _, item := range calendar {
+		showID := item.Show.Ids.Tmdb
+		season := [2]int{showID, item.Episode.Season}
+
+		if !shows[showID] {
+			shows[showID] = true
+
+			_, err = wu.tmdbCli.GetTVShowByID(ctx, showID)
+			check(err, "Cannot prefetch TMDB show")
+
+			_, err = wu.tmdbCli.GetTVShowExternalIDS(ctx, showID)
+			check(err, "Cannot prefetch TMDB external ids")
+		}
+
+		if !seasons[season] {
+			seasons[season] = true
+
+			_, err = wu.tmdbCli.GetTVSeason(ctx, showID, item.Episode.Season)
+			check(err, "Cannot prefetch TMDB season")
+		}
+
+		_, err = wu.tmdbCli.GetTVEpisodeImages(ctx, showID, item.Episode.Season, item.Episode.Number)
+		check(err, "Cannot prefetch TMDB episode stills")
+
+		q, err := showMatchQuery(ctx, wu.tmdbCli, wu.logger, showID)
+		if err == nil {
+			_, err = wu.kpc.GetEpisode(ctx, q, item.Episode.Season, item.Episode.Number)
+		}
+		check(err, "Cannot prefetch kinopub episode")
+	}
+
+	return len(shows), len(calendar), errs
+}
@@ -0,0 +1,120 @@
+package services
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/dpfg/kinohub-core/internal/provider/tmdb"
+	"github.com/dpfg/kinohub-core/internal/provider/trakt"
+	"github.com/go-chi/chi"
+	"github.com/sirupsen/logrus"
+)
+
+// warmupCalendar records the requested period
+type warmupCalendar struct {
+	shows    []trakt.MyShow
+	from, to time.Time
+}
+
+func (c *warmupCalendar) MyShows(ctx context.Context, from time.Time, to time.Time) ([]trakt.MyShow, error) {
+	c.from, c.to = from, to
+	return c.shows, nil
+}
+
+// warmupTMDB knows seasons of every show
+type warmupTMDB struct {
+	feedTMDB
+}
+
+func (c warmupTMDB) GetTVSeason(ctx context.Context, tvID int, seasonNum int) (*tmdb.TVSeason, error) {
+	return &tmdb.TVSeason{}, nil
+}
+
+func newTestWarmUp(t *testing.T, schedule WarmUpSchedule, now time.Time, tc releaseCalendar) *WarmUp {
+	wu, err := NewWarmUp(schedule, nil, feedKinopub{}, warmupTMDB{feedTMDB{broken: 3}}, logrus.NewEntry(logrus.StandardLogger()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wu.tc = tc
+	wu.now = func() time.Time { return now }
+	return wu
+}
+
+func TestWarmUp_nextRun(t *testing.T) {
+	now := time.Date(2019, time.March, 10, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		schedule WarmUpSchedule
+		want     time.Time
+	}{
+		{name: "Interval", schedule: WarmUpSchedule{Interval: 2 * time.Hour}, want: now.Add(2 * time.Hour)},
+		{name: "Later today", schedule: WarmUpSchedule{At: "18:30"}, want: time.Date(2019, time.March, 10, 18, 30, 0, 0, time.UTC)},
+		{name: "Passed today", schedule: WarmUpSchedule{At: "06:00"}, want: time.Date(2019, time.March, 11, 6, 0, 0, 0, time.UTC)},
+		{name: "Right now", schedule: WarmUpSchedule{At: "12:00"}, want: time.Date(2019, time.March, 11, 12, 0, 0, 0, time.UTC)},
+		{name: "Time over interval", schedule: WarmUpSchedule{At: "18:30", Interval: time.Hour}, want: time.Date(2019, time.March, 10, 18, 30, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			wu := newTestWarmUp(t, tt.schedule, now, &warmupCalendar{})
+			if got := wu.nextRun(now); !got.Equal(tt.want) {
+				t.Errorf("nextRun() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWarmUp_Trigger(t *testing.T) {
+	now := time.Date(2019, time.March, 10, 12, 0, 0, 0, time.UTC)
+
+	calendar := &warmupCalendar{}
+	for id := 1; id <= 3; id++ {
+		for ep := 1; ep <= 2; ep++ {
+			show := trakt.MyShow{Episode: trakt.Episode{Season: 1, Number: ep}}
+			show.Show.Ids.Tmdb = id
+			calendar.shows = append(calendar.shows, show)
+		}
+	}
+
+	wu := newTestWarmUp(t, WarmUpSchedule{Days: 2}, now, calendar)
+
+	router := chi.NewRouter()
+	router.Group(wu.Handler())
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/system/warmup", nil))
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("POST = %d, want %d", rec.Code, http.StatusAccepted)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for wu.Status().Running {
+		if time.Now().After(deadline) {
+			t.Fatal("Warm-up has not finished")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if !calendar.from.Equal(now) || !calendar.to.Equal(now.AddDate(0, 0, 2)) {
+		t.Errorf("Calendar period = %v - %v, want %v - %v", calendar.from, calendar.to, now, now.AddDate(0, 0, 2))
+	}
+
+	// the broken show fails to load once and to match both of its episodes
+	status := wu.Status()
+	if !status.StartedAt.Equal(now) || !status.FinishedAt.Equal(now) || status.Shows != 3 || status.Episodes != 6 || len(status.Errors) != 3 {
+		t.Errorf("Status() = %+v, want 3 shows, 6 episodes and 3 errors", status)
+	}
+
+	// manual run is rejected while another one is in progress
+	wu.start()
+
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/system/warmup", nil))
+	if rec.Code != http.StatusConflict {
+		t.Errorf("POST = %d, want %d", rec.Code, http.StatusConflict)
+	}
+}
@@ -0,0 +1,92 @@
+package stream
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Stream formats
+const (
+	FormatHLS  = "hls"
+	FormatHTTP = "http"
+)
+
+// DefaultProfileName is used when neither request nor player selects a profile
+const DefaultProfileName = "default"
+
+// Profile describes capabilities and preferences of the player
+type Profile struct {
+	// MaxHeight limits resolution of the video, e.g. 1080. Zero means no limit.
+	MaxHeight int `json:"max_height,omitempty"`
+	// Format is either hls (adaptive) or http (progressive)
+	Format string `json:"format"`
+	// NoHEVC excludes h265 encoded files
+	NoHEVC bool `json:"no_hevc,omitempty"`
+	// AC3 tells that the player passes AC3 audio through to the receiver
+	AC3 bool `json:"ac3,omitempty"`
+	// Voice is a part of the preferred audio track title or language, e.g. LostFilm or eng
+	Voice string `json:"voice,omitempty"`
+}
+
+// DefaultProfile plays the best available HLS stream
+var DefaultProfile = Profile{Format: FormatHLS}
+
+// ParseProfile parses profile definition in the form of
+// NAME:max-height=1080,format=hls,no-hevc,ac3,voice=LostFilm
+func ParseProfile(def string) (string, Profile, error) {
+	profile := DefaultProfile
+
+	sep := strings.Index(def, ":")
+	if sep <= 0 {
+		return "", profile, errors.Errorf("Invalid stream profile [%s]: profile name is missing", def)
+	}
+
+	name := strings.TrimSpace(def[:sep])
+	for _, opt := range strings.Split(def[sep+1:], ",") {
+		opt = strings.TrimSpace(opt)
+		if opt == "" {
+			continue
+		}
+
+		kv := strings.SplitN(opt, "=", 2)
+		switch {
+		case kv[0] == "no-hevc" && len(kv) == 1:
+			profile.NoHEVC = true
+		case kv[0] == "ac3" && len(kv) == 1:
+			profile.AC3 = true
+		case kv[0] == "max-height" && len(kv) == 2:
+			h, err := strconv.Atoi(kv[1])
+			if err != nil || h < 0 {
+				return "", profile, errors.Errorf("Invalid max height of stream profile [%s]", def)
+			}
+			profile.MaxHeight = h
+		case kv[0] == "format" && len(kv) == 2:
+			if kv[1] != FormatHLS && kv[1] != FormatHTTP {
+				return "", profile, errors.Errorf("Invalid format of stream profile [%s]", def)
+			}
+			profile.Format = kv[1]
+		case kv[0] == "voice" && len(kv) == 2:
+			profile.Voice = kv[1]
+		default:
+			return "", profile, errors.Errorf("Invalid stream profile [%s]: unknown option [%s]", def, opt)
+		}
+	}
+
+	return name, profile, nil
+}
+
+// ParseProfiles parses list of profile definitions
+func ParseProfiles(defs []string) (map[string]Profile, error) {
+	profiles := make(map[string]Profile, len(defs))
+	for _, def := range defs {
+		name, profile, err := ParseProfile(def)
+		if err != nil {
+			return nil, err
+		}
+		profiles[name] = profile
+	}
+
+	return profiles, nil
+}
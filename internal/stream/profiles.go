@@ -0,0 +1,148 @@
+package stream
+
+import (
+	"net/http"
+	"sync"
+
+	provider "github.com/dpfg/kinohub-core/internal/provider"
+	httpu "github.com/dpfg/kinohub-core/pkg/http"
+	"github.com/go-chi/chi"
+	"github.com/go-chi/render"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// PlayersPrefKey is the preferences key of the profiles assigned to the players
+const PlayersPrefKey = "stream-players"
+
+// ErrUnknownProfile tells that there is no profile with the requested name
+var ErrUnknownProfile = errors.New("unknown stream profile")
+
+// Profiles keeps named profiles and the profiles assigned to the players
+type Profiles struct {
+	profiles map[string]Profile
+	storage  provider.PreferenceStorage
+	logger   *logrus.Entry
+
+	mu      sync.Mutex
+	players map[string]string
+}
+
+// NewProfiles creates registry of the profiles. Default profile is added unless it's overridden.
+func NewProfiles(profiles map[string]Profile, storage provider.PreferenceStorage, logger *logrus.Entry) *Profiles {
+	all := map[string]Profile{DefaultProfileName: DefaultProfile}
+	for name, p := range profiles {
+		all[name] = p
+	}
+
+	players := make(map[string]string)
+	if err := storage.Load(PlayersPrefKey, &players); err != nil {
+		logger.Debugf("No stream profiles assigned to players: %s", err.Error())
+		players = make(map[string]string)
+	}
+
+	return &Profiles{
+		profiles: all,
+		storage:  storage,
+		logger:   logger,
+		players:  players,
+	}
+}
+
+// Resolve returns the profile requested by name or, if the name is empty, the one assigned to the player.
+// Only the requested profile has to exist: player falls back to the default profile if its one was removed from config.
+func (ps *Profiles) Resolve(name string, playerID string) (string, Profile, error) {
+	if name == "" {
+		name = ps.PlayerProfile(playerID)
+		if _, ok := ps.profiles[name]; !ok {
+			ps.logger.Warnf("Profile [%s] of player [%s] is not configured, using the default one", name, playerID)
+			name = DefaultProfileName
+		}
+	}
+
+	p, ok := ps.profiles[name]
+	if !ok {
+		return "", p, errors.WithMessage(ErrUnknownProfile, name)
+	}
+
+	return name, p, nil
+}
+
+// PlayerProfile returns name of the profile assigned to the player
+func (ps *Profiles) PlayerProfile(playerID string) string {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	if name, ok := ps.players[playerID]; ok {
+		return name
+	}
+
+	return DefaultProfileName
+}
+
+// AssignProfile assigns the profile to the player. Empty name resets the player to the default profile.
+func (ps *Profiles) AssignProfile(playerID string, name string) error {
+	if _, ok := ps.profiles[name]; name != "" && !ok {
+		return errors.WithMessage(ErrUnknownProfile, name)
+	}
+
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	players := make(map[string]string, len(ps.players)+1)
+	for k, v := range ps.players {
+		players[k] = v
+	}
+
+	if name == "" {
+		delete(players, playerID)
+	} else {
+		players[playerID] = name
+	}
+
+	if err := ps.storage.Save(PlayersPrefKey, players); err != nil {
+		return errors.WithMessage(err, "Cannot save stream profiles of players")
+	}
+
+	ps.players = players
+	return nil
+}
+
+// Handler returns http.Handler to list the profiles and assign them to the players
+func (ps *Profiles) Handler() http.Handler {
+	router := chi.NewRouter()
+
+	router.Get("/profiles", func(w http.ResponseWriter, req *http.Request) {
+		render.JSON(w, req, ps.profiles)
+	})
+
+	router.Get("/players/{pid}", func(w http.ResponseWriter, req *http.Request) {
+		render.JSON(w, req, map[string]string{"profile": ps.PlayerProfile(chi.URLParam(req, "pid"))})
+	})
+
+	router.Put("/players/{pid}", func(w http.ResponseWriter, req *http.Request) {
+		body := struct {
+			Profile string `json:"profile"`
+		}{}
+
+		if err := render.DecodeJSON(req.Body, &body); err != nil {
+			httpu.BadRequest(w, req, err)
+			return
+		}
+
+		err := ps.AssignProfile(chi.URLParam(req, "pid"), body.Profile)
+		if errors.Cause(err) == ErrUnknownProfile {
+			httpu.BadRequest(w, req, err)
+			return
+		}
+
+		if err != nil {
+			httpu.InternalError(w, req, err)
+			return
+		}
+
+		render.NoContent(w, req)
+	})
+
+	return router
+}
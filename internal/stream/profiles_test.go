@@ -0,0 +1,76 @@
+package stream
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	provider "github.com/dpfg/kinohub-core/internal/provider"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+func TestProfiles_AssignProfile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "profiles")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	storage := provider.JSONPreferenceStorage{Path: dir}
+	logger := logrus.NewEntry(logrus.StandardLogger())
+	tv := Profile{Format: FormatHLS, MaxHeight: 1080, NoHEVC: true}
+
+	ps := NewProfiles(map[string]Profile{"lg-tv": tv}, storage, logger)
+	if err = ps.AssignProfile("player-1", "lg-tv"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = ps.AssignProfile("player-1", "unknown"); err == nil {
+		t.Errorf("Expected unknown profile to be rejected")
+	}
+
+	// assignments survive restart
+	ps = NewProfiles(map[string]Profile{"lg-tv": tv}, storage, logger)
+
+	name, profile, err := ps.Resolve("", "player-1")
+	if err != nil || name != "lg-tv" || profile != tv {
+		t.Errorf("Resolve() = %v, %+v, %v, want assigned profile", name, profile, err)
+	}
+
+	if name, _, _ = ps.Resolve("", "player-2"); name != DefaultProfileName {
+		t.Errorf("Expected default profile of unknown player, got %v", name)
+	}
+
+	if name, _, _ = ps.Resolve(DefaultProfileName, "player-1"); name != DefaultProfileName {
+		t.Errorf("Expected requested profile to override assigned one, got %v", name)
+	}
+}
+
+func TestProfiles_ResolveRemovedProfile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "profiles")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	storage := provider.JSONPreferenceStorage{Path: dir}
+	logger := logrus.NewEntry(logrus.StandardLogger())
+
+	ps := NewProfiles(map[string]Profile{"lg-tv": {Format: FormatHLS}}, storage, logger)
+	if err = ps.AssignProfile("player-1", "lg-tv"); err != nil {
+		t.Fatal(err)
+	}
+
+	// profile is removed from config after restart
+	ps = NewProfiles(nil, storage, logger)
+
+	name, profile, err := ps.Resolve("", "player-1")
+	if err != nil || name != DefaultProfileName || profile != DefaultProfile {
+		t.Errorf("Resolve() = %v, %+v, %v, want default profile", name, profile, err)
+	}
+
+	if _, _, err = ps.Resolve("lg-tv", "player-1"); errors.Cause(err) != ErrUnknownProfile {
+		t.Errorf("Resolve() error = %v, want %v for requested profile", err, ErrUnknownProfile)
+	}
+}
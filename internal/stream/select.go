@@ -0,0 +1,116 @@
+package stream
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/dpfg/kinohub-core/domain"
+	"github.com/pkg/errors"
+)
+
+// ErrNoStream tells that none of the files can be played with the profile
+var ErrNoStream = errors.New("no stream matches the profile")
+
+// Select returns the highest resolution stream that the profile can play
+func Select(files []domain.File, audios []domain.AudioTrack, profile Profile) (*domain.Stream, error) {
+	audio := selectAudio(audios, profile)
+
+	// single audio HLS can't switch tracks, so use multi audio one if a specific track is required
+	multiAudio := profile.AC3 || audio != nil
+
+	var best *domain.Stream
+	for _, f := range files {
+		height := fileHeight(f)
+		if profile.MaxHeight > 0 && height > profile.MaxHeight {
+			continue
+		}
+
+		if profile.NoHEVC && isHEVC(f.Codec) {
+			continue
+		}
+
+		url := fileURL(f, profile.Format, multiAudio)
+		if url == "" {
+			continue
+		}
+
+		if best != nil && best.Height >= height {
+			continue
+		}
+
+		best = &domain.Stream{
+			URL:     url,
+			Format:  profile.Format,
+			Quality: f.Quality,
+			Height:  height,
+			Codec:   f.Codec,
+		}
+	}
+
+	if best == nil {
+		return nil, ErrNoStream
+	}
+
+	if profile.Format == FormatHLS && multiAudio {
+		best.AudioTrack = audio
+	}
+
+	return best, nil
+}
+
+// selectAudio returns the track of the preferred voice. AC3 tracks are skipped unless passed through.
+func selectAudio(audios []domain.AudioTrack, profile Profile) *domain.AudioTrack {
+	if profile.Voice == "" {
+		return nil
+	}
+
+	voice := strings.ToLower(profile.Voice)
+	for i := range audios {
+		a := audios[i]
+		if !profile.AC3 && strings.EqualFold(a.Codec, "ac3") {
+			continue
+		}
+
+		if strings.Contains(strings.ToLower(a.Title), voice) || strings.EqualFold(a.Lang, voice) {
+			return &a
+		}
+	}
+
+	return nil
+}
+
+func fileURL(f domain.File, format string, multiAudio bool) string {
+	if format == FormatHTTP {
+		return f.URL.HTTP
+	}
+
+	if multiAudio && f.URL.Hls4 != "" {
+		return f.URL.Hls4
+	}
+
+	if f.URL.Hls != "" {
+		return f.URL.Hls
+	}
+
+	return f.URL.Hls4
+}
+
+// fileHeight returns height of the video, falling back to the quality label like 720p
+func fileHeight(f domain.File) int {
+	if f.Height > 0 {
+		return f.Height
+	}
+
+	quality := strings.ToLower(f.Quality)
+	if quality == "4k" {
+		return 2160
+	}
+
+	h, _ := strconv.Atoi(strings.TrimSuffix(quality, "p"))
+	return h
+}
+
+func isHEVC(codec string) bool {
+	codec = strings.ToLower(codec)
+	return codec == "h265" || codec == "hevc"
+}
@@ -0,0 +1,109 @@
+package stream
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/dpfg/kinohub-core/domain"
+)
+
+func testFile(quality string, height int, codec string) domain.File {
+	f := domain.File{Quality: quality, Height: height, Codec: codec}
+	f.URL.HTTP = "http://example/" + quality + ".mp4"
+	f.URL.Hls = "http://example/" + quality + ".m3u8"
+	f.URL.Hls4 = "http://example/" + quality + ".multi.m3u8"
+	return f
+}
+
+func TestSelect(t *testing.T) {
+	files := []domain.File{
+		testFile("480p", 480, "h264"),
+		testFile("1080p", 1080, "h264"),
+		testFile("4K", 0, "h265"),
+		testFile("720p", 720, "h264"),
+	}
+
+	audios := []domain.AudioTrack{
+		{Index: 1, Lang: "rus", Title: "Dubbing", Codec: "aac"},
+		{Index: 2, Lang: "rus", Title: "Voice-over (LostFilm)", Codec: "ac3"},
+		{Index: 3, Lang: "rus", Title: "Voice-over (LostFilm)", Codec: "aac"},
+		{Index: 4, Lang: "eng", Codec: "aac"},
+	}
+
+	tests := []struct {
+		name      string
+		profile   Profile
+		wantURL   string
+		wantAudio int
+		wantErr   bool
+	}{
+		{name: "Default", profile: DefaultProfile, wantURL: "http://example/4K.m3u8"},
+		{name: "No HEVC", profile: Profile{Format: FormatHLS, NoHEVC: true}, wantURL: "http://example/1080p.m3u8"},
+		{name: "Max height", profile: Profile{Format: FormatHLS, MaxHeight: 720}, wantURL: "http://example/720p.m3u8"},
+		{name: "Progressive", profile: Profile{Format: FormatHTTP, MaxHeight: 1080}, wantURL: "http://example/1080p.mp4"},
+		{name: "AC3", profile: Profile{Format: FormatHLS, MaxHeight: 1080, AC3: true}, wantURL: "http://example/1080p.multi.m3u8"},
+		{name: "Voice", profile: Profile{Format: FormatHLS, MaxHeight: 480, Voice: "lostfilm"}, wantURL: "http://example/480p.multi.m3u8", wantAudio: 3},
+		{name: "Voice with AC3", profile: Profile{Format: FormatHLS, MaxHeight: 480, Voice: "LostFilm", AC3: true}, wantURL: "http://example/480p.multi.m3u8", wantAudio: 2},
+		{name: "Voice by language", profile: Profile{Format: FormatHLS, MaxHeight: 480, Voice: "eng"}, wantURL: "http://example/480p.multi.m3u8", wantAudio: 4},
+		{name: "Too low", profile: Profile{Format: FormatHLS, MaxHeight: 360}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Select(files, audios, tt.profile)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Select() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if tt.wantErr {
+				return
+			}
+
+			if got.URL != tt.wantURL {
+				t.Errorf("Select() URL = %v, want %v", got.URL, tt.wantURL)
+			}
+
+			audio := 0
+			if got.AudioTrack != nil {
+				audio = got.AudioTrack.Index
+			}
+
+			if audio != tt.wantAudio {
+				t.Errorf("Select() audio = %v, want %v", audio, tt.wantAudio)
+			}
+		})
+	}
+}
+
+func TestParseProfile(t *testing.T) {
+	tests := []struct {
+		name        string
+		def         string
+		wantName    string
+		wantProfile Profile
+		wantErr     bool
+	}{
+		{name: "Defaults", def: "box:", wantName: "box", wantProfile: DefaultProfile},
+		{
+			name:        "All options",
+			def:         "lg-tv: max-height=1080, format=http, no-hevc, ac3, voice=LostFilm",
+			wantName:    "lg-tv",
+			wantProfile: Profile{MaxHeight: 1080, Format: FormatHTTP, NoHEVC: true, AC3: true, Voice: "LostFilm"},
+		},
+		{name: "Missing name", def: ":ac3", wantErr: true},
+		{name: "Invalid format", def: "tv:format=dash", wantErr: true},
+		{name: "Invalid height", def: "tv:max-height=hd", wantErr: true},
+		{name: "Unknown option", def: "tv:hdr", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			name, profile, err := ParseProfile(tt.def)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ParseProfile() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !tt.wantErr && (name != tt.wantName || !reflect.DeepEqual(profile, tt.wantProfile)) {
+				t.Errorf("ParseProfile() = %v, %+v, want %v, %+v", name, profile, tt.wantName, tt.wantProfile)
+			}
+		})
+	}
+}
@@ -17,6 +17,8 @@ const (
 
 type Opts struct {
 	ServerCmd cmd.ServerCommand `command:"server"`
+	CacheCmd  cmd.CacheCommand  `command:"cache" description:"Manage metadata cache"`
+	AuthCmd   cmd.AuthCommand   `command:"auth" description:"Connect 3rd party accounts"`
 }
 
 func main() {
@@ -0,0 +1,86 @@
+package util
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"sync/atomic"
+)
+
+// StaleWarningHeader is added to responses built from the expired data
+const StaleWarningHeader = `110 - "Response is Stale"`
+
+type staleKey struct{}
+
+// staleFlag is set when the data of the request has been served from the expired cache entry
+type staleFlag struct {
+	served int32
+}
+
+// MarkStale records that the response to the request of the context is built from the
+// expired data. Contexts that don't belong to a request handled by StaleWarning are ignored.
+func MarkStale(ctx context.Context) {
+	if flag, ok := ctx.Value(staleKey{}).(*staleFlag); ok {
+		atomic.StoreInt32(&flag.served, 1)
+	}
+}
+
+// StaleWarning returns middleware that adds Warning header to the response
+// when MarkStale has been called with the request context.
+func StaleWarning(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		flag := &staleFlag{}
+		ctx := context.WithValue(r.Context(), staleKey{}, flag)
+
+		next.ServeHTTP(&staleWriter{ResponseWriter: w, flag: flag}, r.WithContext(ctx))
+	})
+}
+
+type staleWriter struct {
+	http.ResponseWriter
+
+	flag        *staleFlag
+	wroteHeader bool
+}
+
+func (w *staleWriter) WriteHeader(code int) {
+	if !w.wroteHeader {
+		w.wroteHeader = true
+		if atomic.LoadInt32(&w.flag.served) != 0 {
+			w.Header().Add("Warning", StaleWarningHeader)
+		}
+	}
+
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *staleWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+
+	return w.ResponseWriter.Write(b)
+}
+
+// Flush lets streamed responses go through the middleware
+func (w *staleWriter) Flush() {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack lets websocket connections go through the middleware
+func (w *staleWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("hijacking is not supported")
+	}
+
+	return h.Hijack()
+}
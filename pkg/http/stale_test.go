@@ -0,0 +1,84 @@
+package util
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestStaleWarning(t *testing.T) {
+	tests := []struct {
+		name      string
+		stale     bool
+		wantFlush bool
+	}{
+		{name: "Fresh"},
+		{name: "Stale", stale: true},
+		{name: "Flushed stale", stale: true, wantFlush: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := StaleWarning(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if tt.stale {
+					MarkStale(r.Context())
+				}
+
+				if tt.wantFlush {
+					f, ok := w.(http.Flusher)
+					if !ok {
+						t.Fatalf("Writer doesn't implement http.Flusher")
+					}
+					f.Flush()
+				}
+
+				w.Write([]byte("ok"))
+			}))
+
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+
+			if got := rec.Header().Get("Warning") == StaleWarningHeader; got != tt.stale {
+				t.Errorf("Warning header = %q, want stale %v", rec.Header().Get("Warning"), tt.stale)
+			}
+
+			if rec.Flushed != tt.wantFlush {
+				t.Errorf("Flushed = %v, want %v", rec.Flushed, tt.wantFlush)
+			}
+		})
+	}
+}
+
+func TestStaleWarning_ConcurrentRequests(t *testing.T) {
+	// stale data served to one request must not mark the response to another
+	release := make(chan struct{})
+	marked := make(chan struct{})
+	handler := StaleWarning(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/stale" {
+			MarkStale(r.Context())
+			close(marked)
+			<-release
+		}
+		w.Write([]byte("ok"))
+	}))
+
+	staleRec := httptest.NewRecorder()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		handler.ServeHTTP(staleRec, httptest.NewRequest(http.MethodGet, "/stale", nil))
+	}()
+
+	<-marked
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/fresh", nil))
+	close(release)
+	<-done
+
+	if rec.Header().Get("Warning") != "" {
+		t.Errorf("Fresh response is marked stale")
+	}
+
+	if staleRec.Header().Get("Warning") != StaleWarningHeader {
+		t.Errorf("Stale response is not marked")
+	}
+}
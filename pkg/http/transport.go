@@ -0,0 +1,387 @@
+package util
+
+import (
+	"context"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// ErrCircuitOpen is returned without calling the provider while it's considered down
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+// TransportOptions configures resilience of the requests to a single provider
+type TransportOptions struct {
+	// Name of the provider used in the errors and logs
+	Name string
+	// Timeout of a single attempt including reading of the response body
+	Timeout time.Duration
+
+	// MaxRetries is the number of retries after the first attempt
+	MaxRetries int
+	// MinBackoff and MaxBackoff bound the jittered exponential delay between the attempts
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+	// MaxRetryAfter is the longest Retry-After the transport waits for. Longer ones are returned to the caller.
+	MaxRetryAfter time.Duration
+
+	// RateLimit is the number of requests per second. Zero disables the limiter.
+	RateLimit float64
+	// Burst is the number of requests that can be sent at once
+	Burst int
+
+	// BreakerThreshold is the number of consecutive failures that opens the breaker. Zero disables the breaker.
+	BreakerThreshold int
+	// BreakerCooldown is the time the breaker stays open before a trial request is let through
+	BreakerCooldown time.Duration
+
+	Logger *logrus.Entry
+}
+
+// Transport is http.RoundTripper that adds timeouts, retries, rate limiting and
+// circuit breaking to the underlying transport
+type Transport struct {
+	opts    TransportOptions
+	next    http.RoundTripper
+	limiter *tokenBucket
+	breaker *breaker
+}
+
+// NewTransport wraps next transport. http.DefaultTransport is used if next is nil.
+func NewTransport(opts TransportOptions, next http.RoundTripper) *Transport {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+
+	if opts.Logger == nil {
+		opts.Logger = logrus.NewEntry(logrus.StandardLogger())
+	}
+
+	t := &Transport{opts: opts, next: next}
+	if opts.RateLimit > 0 {
+		t.limiter = newTokenBucket(opts.RateLimit, opts.Burst)
+	}
+
+	if opts.BreakerThreshold > 0 {
+		t.breaker = &breaker{threshold: opts.BreakerThreshold, cooldown: opts.BreakerCooldown}
+	}
+
+	return t
+}
+
+// NewClient creates http.Client with resilient transport
+func NewClient(opts TransportOptions) *http.Client {
+	return &http.Client{Transport: NewTransport(opts, nil)}
+}
+
+// RoundTrip sends the request retrying failed attempts
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Body != nil && req.GetBody == nil {
+		// body can't be replayed, so the request is sent only once
+		return t.attempt(req)
+	}
+
+	for retry := 0; ; retry++ {
+		r := req
+		if retry > 0 && req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+
+			// round tripper must not modify the request, so the copy gets a fresh body
+			r = req.WithContext(req.Context())
+			r.Body = body
+		}
+
+		resp, err := t.attempt(r)
+		if retry >= t.opts.MaxRetries || errors.Cause(err) == ErrCircuitOpen {
+			return resp, err
+		}
+
+		wait, retryable := t.retryDelay(req, resp, err, retry)
+		if !retryable {
+			return resp, err
+		}
+
+		t.opts.Logger.Debugf("Retrying %s %s in %s: %s", req.Method, req.URL.Path, wait, describe(resp, err))
+		if resp != nil {
+			resp.Body.Close()
+		}
+
+		if err := sleep(req.Context(), wait); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// attempt sends the request once respecting the rate limit, the breaker and the timeout
+func (t *Transport) attempt(req *http.Request) (*http.Response, error) {
+	if t.limiter != nil {
+		if err := t.limiter.wait(req.Context()); err != nil {
+			return nil, err
+		}
+	}
+
+	if t.breaker != nil && !t.breaker.allow() {
+		return nil, errors.WithMessage(ErrCircuitOpen, t.opts.Name)
+	}
+
+	ctx, cancel := req.Context(), context.CancelFunc(func() {})
+	if t.opts.Timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, t.opts.Timeout)
+	}
+
+	resp, err := t.next.RoundTrip(req.WithContext(ctx))
+	if t.breaker != nil {
+		switch {
+		case err == nil:
+			t.breaker.record(resp.StatusCode < http.StatusInternalServerError)
+		case req.Context().Err() != nil:
+			// cancelled by the caller, so it tells nothing about the provider
+			t.breaker.release()
+		default:
+			t.breaker.record(false)
+		}
+	}
+
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	// the timeout covers reading of the body, so it's cancelled once the body is closed
+	resp.Body = &cancelBody{ReadCloser: resp.Body, cancel: cancel}
+	return resp, nil
+}
+
+// retryDelay tells whether the failed attempt should be retried and how long to wait before it
+func (t *Transport) retryDelay(req *http.Request, resp *http.Response, err error, retry int) (time.Duration, bool) {
+	if err != nil {
+		if req.Context().Err() != nil {
+			return 0, false
+		}
+		return t.backoff(retry), idempotent(req.Method)
+	}
+
+	if resp.StatusCode == http.StatusTooManyRequests {
+		// the request was rejected, so it's safe to send it again whatever the method is
+		wait, ok := retryAfter(resp.Header.Get("Retry-After"), time.Now())
+		if !ok {
+			return t.backoff(retry), true
+		}
+		return wait, t.opts.MaxRetryAfter <= 0 || wait <= t.opts.MaxRetryAfter
+	}
+
+	if resp.StatusCode >= http.StatusInternalServerError {
+		return t.backoff(retry), idempotent(req.Method)
+	}
+
+	return 0, false
+}
+
+// backoff returns random delay up to the exponentially growing limit (full jitter)
+func (t *Transport) backoff(retry int) time.Duration {
+	limit := t.opts.MinBackoff << uint(retry)
+	if limit <= 0 || (t.opts.MaxBackoff > 0 && limit > t.opts.MaxBackoff) {
+		limit = t.opts.MaxBackoff
+	}
+
+	if limit <= 0 {
+		return 0
+	}
+
+	return time.Duration(rand.Int63n(int64(limit)))
+}
+
+// retryAfter parses Retry-After header that is either a number of seconds or a date
+func retryAfter(value string, now time.Time) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+
+	if s, err := strconv.Atoi(value); err == nil {
+		if s < 0 {
+			return 0, false
+		}
+		return time.Duration(s) * time.Second, true
+	}
+
+	at, err := http.ParseTime(value)
+	if err != nil {
+		return 0, false
+	}
+
+	if wait := at.Sub(now); wait > 0 {
+		return wait, true
+	}
+
+	return 0, true
+}
+
+func idempotent(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+func describe(resp *http.Response, err error) string {
+	if err != nil {
+		return err.Error()
+	}
+	return resp.Status
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+type cancelBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
+
+// tokenBucket allows bursts of requests while keeping the average rate
+type tokenBucket struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(rate float64, burst int) *tokenBucket {
+	if burst < 1 {
+		burst = 1
+	}
+
+	return &tokenBucket{rate: rate, burst: float64(burst), tokens: float64(burst), last: time.Now()}
+}
+
+// reserve takes a token and returns how long the caller has to wait until the token is available
+func (tb *tokenBucket) reserve(now time.Time) time.Duration {
+	tb.mu.Lock()
+	defer tb.mu.Unlock()
+
+	tb.tokens += now.Sub(tb.last).Seconds() * tb.rate
+	if tb.tokens > tb.burst {
+		tb.tokens = tb.burst
+	}
+	tb.last = now
+
+	tb.tokens--
+	if tb.tokens >= 0 {
+		return 0
+	}
+
+	return time.Duration(-tb.tokens / tb.rate * float64(time.Second))
+}
+
+func (tb *tokenBucket) wait(ctx context.Context) error {
+	wait := tb.reserve(time.Now())
+	if wait == 0 {
+		return nil
+	}
+
+	return sleep(ctx, wait)
+}
+
+// breaker opens after the number of consecutive failures and lets a single trial request through after the cooldown
+type breaker struct {
+	mu        sync.Mutex
+	threshold int
+	cooldown  time.Duration
+
+	failures  int
+	openUntil time.Time
+	trial     bool
+}
+
+func (b *breaker) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.failures < b.threshold {
+		return true
+	}
+
+	if time.Now().Before(b.openUntil) || b.trial {
+		return false
+	}
+
+	b.trial = true
+	return true
+}
+
+// release ends the trial without changing the state of the breaker
+func (b *breaker) release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.trial = false
+}
+
+func (b *breaker) record(success bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.trial = false
+	if success {
+		b.failures = 0
+		return
+	}
+
+	b.failures++
+	if b.failures >= b.threshold {
+		b.openUntil = time.Now().Add(b.cooldown)
+	}
+}
+
+// NewRequest creates request bound to the context with the query parameters.
+// Form values, if any, are sent as url-encoded body.
+func NewRequest(ctx context.Context, method, uri string, query url.Values, form url.Values) (*http.Request, error) {
+	var body io.Reader
+	if form != nil {
+		body = strings.NewReader(form.Encode())
+	}
+
+	req, err := http.NewRequest(method, uri, body)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	req = req.WithContext(ctx)
+
+	if len(query) > 0 {
+		req.URL.RawQuery = query.Encode()
+	}
+
+	if form != nil {
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+
+	return req, nil
+}
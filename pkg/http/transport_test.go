@@ -0,0 +1,157 @@
+package util
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// testServer responds with the statuses in order, repeating the last one
+func testServer(statuses ...int) (*httptest.Server, *int32) {
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := int(atomic.AddInt32(&calls, 1))
+		if n > len(statuses) {
+			n = len(statuses)
+		}
+
+		if statuses[n-1] == http.StatusTooManyRequests {
+			w.Header().Set("Retry-After", "0")
+		}
+		w.WriteHeader(statuses[n-1])
+	}))
+
+	return srv, &calls
+}
+
+func TestTransportRetries(t *testing.T) {
+	tests := []struct {
+		name       string
+		method     string
+		statuses   []int
+		wantStatus int
+		wantCalls  int32
+	}{
+		{name: "Success", method: "GET", statuses: []int{200}, wantStatus: 200, wantCalls: 1},
+		{name: "Server error", method: "GET", statuses: []int{502, 503, 200}, wantStatus: 200, wantCalls: 3},
+		{name: "Retries exhausted", method: "GET", statuses: []int{500}, wantStatus: 500, wantCalls: 3},
+		{name: "Client error", method: "GET", statuses: []int{404}, wantStatus: 404, wantCalls: 1},
+		{name: "Too many requests", method: "POST", statuses: []int{429, 200}, wantStatus: 200, wantCalls: 2},
+		{name: "Not idempotent", method: "POST", statuses: []int{500, 200}, wantStatus: 500, wantCalls: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, calls := testServer(tt.statuses...)
+			defer srv.Close()
+
+			client := NewClient(TransportOptions{Name: "test", MaxRetries: 2, MinBackoff: time.Millisecond, MaxBackoff: time.Millisecond})
+
+			req, err := NewRequest(context.Background(), tt.method, srv.URL, nil, url.Values{"q": {"x"}})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			resp, err := client.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+
+			if resp.StatusCode != tt.wantStatus {
+				t.Errorf("Status = %d, want %d", resp.StatusCode, tt.wantStatus)
+			}
+
+			if got := atomic.LoadInt32(calls); got != tt.wantCalls {
+				t.Errorf("Calls = %d, want %d", got, tt.wantCalls)
+			}
+		})
+	}
+}
+
+func TestTransportBreaker(t *testing.T) {
+	srv, calls := testServer(500)
+	defer srv.Close()
+
+	client := NewClient(TransportOptions{Name: "test", BreakerThreshold: 2, BreakerCooldown: 50 * time.Millisecond})
+
+	for i := 0; i < 2; i++ {
+		resp, err := client.Get(srv.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+	}
+
+	if _, err := client.Get(srv.URL); errors.Cause(err.(*url.Error).Err) != ErrCircuitOpen {
+		t.Errorf("Expected open breaker, got %v", err)
+	}
+
+	if got := atomic.LoadInt32(calls); got != 2 {
+		t.Errorf("Calls = %d, want 2", got)
+	}
+
+	time.Sleep(60 * time.Millisecond)
+
+	// trial request is let through after the cooldown
+	resp, err := client.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if got := atomic.LoadInt32(calls); got != 3 {
+		t.Errorf("Calls = %d, want 3", got)
+	}
+}
+
+func TestTokenBucket(t *testing.T) {
+	tb := newTokenBucket(4, 2)
+	now := tb.last
+
+	if wait := tb.reserve(now); wait != 0 {
+		t.Errorf("First token should be available, wait %s", wait)
+	}
+
+	if wait := tb.reserve(now); wait != 0 {
+		t.Errorf("Second token should be available, wait %s", wait)
+	}
+
+	if wait := tb.reserve(now); wait != 250*time.Millisecond {
+		t.Errorf("Third token should be available in 250ms, wait %s", wait)
+	}
+
+	if wait := tb.reserve(now.Add(time.Second)); wait != 0 {
+		t.Errorf("Token should be refilled, wait %s", wait)
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	now := time.Date(2020, 11, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		value    string
+		wantWait time.Duration
+		wantOK   bool
+	}{
+		{value: "", wantOK: false},
+		{value: "5", wantWait: 5 * time.Second, wantOK: true},
+		{value: "-1", wantOK: false},
+		{value: "Sun, 01 Nov 2020 12:00:30 GMT", wantWait: 30 * time.Second, wantOK: true},
+		{value: "Sun, 01 Nov 2020 11:00:00 GMT", wantWait: 0, wantOK: true},
+		{value: "soon", wantOK: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			wait, ok := retryAfter(tt.value, now)
+			if wait != tt.wantWait || ok != tt.wantOK {
+				t.Errorf("retryAfter() = %s, %v, want %s, %v", wait, ok, tt.wantWait, tt.wantOK)
+			}
+		})
+	}
+}